@@ -0,0 +1,69 @@
+package cogs
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"os/user"
+	"sync"
+	"time"
+)
+
+// AuditLog receives an AuditEvent as a JSON line every time a context reads values from a decrypted path,
+// such as a file or stderr. Auditing is disabled if AuditLog is nil
+var AuditLog io.Writer
+
+// AuditEvent records which keys a context read from a decrypted path, values are never recorded
+type AuditEvent struct {
+	Time time.Time `json:"time"`
+	User string    `json:"user"`
+	Host string    `json:"host"`
+	Ctx  string    `json:"ctx"`
+	Path string    `json:"path"` // the decrypted file path or URL
+	Keys []string  `json:"keys"` // the context keys whose values were read from Path
+}
+
+var (
+	auditMu   sync.Mutex
+	auditUser string
+	auditHost string
+)
+
+// audit writes an AuditEvent to AuditLog if it is set
+func audit(ctxName, path string, keys []string) error {
+	if AuditLog == nil {
+		return nil
+	}
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	if auditHost == "" {
+		auditUser, auditHost = auditIdentity()
+	}
+	b, err := json.Marshal(AuditEvent{
+		Time: time.Now().UTC(),
+		User: auditUser,
+		Host: auditHost,
+		Ctx:  ctxName,
+		Path: path,
+		Keys: keys,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = AuditLog.Write(append(b, '\n'))
+	return err
+}
+
+// auditIdentity returns the current user and host name, falling back to $USER and "unknown"
+func auditIdentity() (userName, host string) {
+	if u, err := user.Current(); err == nil {
+		userName = u.Username
+	} else {
+		userName = os.Getenv("USER")
+	}
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "unknown"
+	}
+	return userName, host
+}
@@ -0,0 +1,94 @@
+package cogs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// MarshalGitHub serializes a Config using the multi-line syntax read by the $GITHUB_ENV and $GITHUB_OUTPUT files
+// of GitHub Actions, each value is enclosed by a random delimiter that the value is checked against:
+//
+//	KEY<<ghadelimiter_<random>
+//	value
+//	ghadelimiter_<random>
+//
+// The Config should be generated using the GitHub Format so that every value is a string.
+// GitHubMasks should be written to stdout before the values are used so that encrypted values are masked
+func MarshalGitHub(cfg *Config) ([]byte, error) {
+	var sb strings.Builder
+	for _, k := range cfg.Keys {
+		v, err := SimpleValueToString(cfg.Values[k])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", k, err)
+		}
+		if strings.ContainsAny(k, "\r\n=") || k == "" {
+			return nil, fmt.Errorf("%q is not a valid GitHub Actions name", k)
+		}
+		delimiter, err := githubDelimiter()
+		if err != nil {
+			return nil, err
+		}
+		if strings.Contains(v, delimiter) {
+			return nil, fmt.Errorf("%s: value contains the generated delimiter", k)
+		}
+		fmt.Fprintf(&sb, "%s<<%s\n%s\n%s\n", k, delimiter, v, delimiter)
+	}
+	return []byte(sb.String()), nil
+}
+
+func githubDelimiter() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "ghadelimiter_" + hex.EncodeToString(b), nil
+}
+
+// GitHubMasks returns an ::add-mask:: workflow command for every value of a Config
+// that was declared in ctx.enc.vars, GitHub Actions masks each line of a log separately
+// so every line of a multi-line value is masked on its own
+func GitHubMasks(cfg *Config) ([]byte, error) {
+	var sb strings.Builder
+	for _, k := range cfg.Keys {
+		if !cfg.Encrypted(k) {
+			continue
+		}
+		v, err := SimpleValueToString(cfg.Values[k])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", k, err)
+		}
+		for _, line := range strings.Split(v, "\n") {
+			if line = strings.TrimSuffix(line, "\r"); line != "" {
+				fmt.Fprintf(&sb, "::add-mask::%s\n", githubEscape(line))
+			}
+		}
+	}
+	return []byte(sb.String()), nil
+}
+
+// githubEscape escapes the characters that GitHub Actions unescapes in workflow command data
+func githubEscape(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+// MarshalGitLab serializes a Config as a GitLab CI dotenv report (artifacts:reports:dotenv),
+// which only supports single line KEY=value pairs without any quoting
+func MarshalGitLab(cfg *Config) ([]byte, error) {
+	var sb strings.Builder
+	for _, k := range cfg.Keys {
+		if !shellVarRegexp.MatchString(k) {
+			return nil, fmt.Errorf("%q is not a valid GitLab CI variable name", k)
+		}
+		v, err := SimpleValueToString(cfg.Values[k])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", k, err)
+		}
+		if strings.ContainsAny(v, "\r\n") {
+			return nil, fmt.Errorf("%s: GitLab dotenv reports do not support multi-line values", k)
+		}
+		fmt.Fprintf(&sb, "%s=%s\n", k, v)
+	}
+	return []byte(sb.String()), nil
+}
@@ -7,7 +7,6 @@ import (
 	"strings"
 
 	"github.com/docopt/docopt-go"
-	"github.com/joho/godotenv"
 	"github.com/pelletier/go-toml"
 	"gopkg.in/op/go-logging.v1"
 	"gopkg.in/yaml.v3"
@@ -21,38 +20,113 @@ COGS COnfiguration manaGement S
 
 Usage:
   cogs gen <ctx> <cog-file> [options]
+  cogs gen --all <cog-file> [options]
+  cogs render <ctx> <cog-file> --template=<file> [options]
+  cogs set <ctx> <cog-file> <key> <value> [options]
+  cogs updatekeys <ctx> <cog-file> [options]
+  cogs updatekeys --all <cog-file> [options]
+  cogs lint <ctx> <cog-file> [options]
+  cogs lint --all <cog-file> [options]
 
 Options:
   -h --help        Show this screen.
   --version        Show version.
+  --all, -a        Generate every context in the cog file,
+                   <ctx> can also be a glob pattern to generate many contexts: 'prod-*'.
   --no-enc, -n     Skips fetching encrypted vars.
   --no-decrypt	   Skips decrypting encrypted vars.
   --envsubst, -e   Perform environmental substitution on the given cog file.
+  --age-key-file=<file>  Decrypts using the age identities in <file> instead of $SOPS_AGE_KEY_FILE.
+  --gnupg-home=<dir>     Decrypts using the GnuPG home directory <dir> instead of $GNUPGHOME.
+  --key-types=<type,>    Only attempts decrypting with the given SOPS key types, comma separated:
+                         pgp, age, kms, gcp_kms, azure_kv, hc_vault.
+  --keyservice=<uri,>    Also decrypts through the SOPS key services at the given URIs, comma separated:
+                         unix:///path/to/socket or tcp://host:port.
+  --audit-log=<file>     Appends a JSON line for every decrypted path to <file>, "-" for stderr,
+                         listing the keys read along with the context, user, host and time but never values.
   --keys=<key,>    Include specific keys, comma separated.
   --not=<key,>     Exclude specific keys, comma separated.
   --out=<type>     Configuration output type [default: json].
-                   <type>: json, toml, yaml, dotenv, raw.
+                   <type>: json, toml, yaml, dotenv, raw, k8s, compose, properties, ini, tfvars, shell,
+                   github, gitlab.
+  --template=<file>  A text/template file to render using the values of <ctx>.
+  --sort, -s       Sort keys lexicographically instead of by declaration order.
+  --redact, -r     Replaces encrypted values with "***" so that output can be shared.
+  --redact-hash    Replaces encrypted values with a short HMAC-SHA256 instead, to tell values apart,
+                   keyed by $COGS_REDACT_KEY or a random key for each run.
+  --write, -w      Write every output declared under [<ctx>.outputs] instead of stdout.
+  --check          Fail if any output declared under [<ctx>.outputs] is stale.
+  --encrypt-out    Encrypts json, yaml or dotenv output with SOPS for the creation rule of the nearest .sops.yaml,
+                   matching the cog file or each output declared under [<ctx>.outputs] if --write.
+  --pgp=<fp,>      If --encrypt-out: Encrypts for the given PGP fingerprints instead, comma separated.
+  --age=<key,>     If --encrypt-out: Encrypts for the given age recipients instead, comma separated.
+  --enc-only       If --encrypt-out: Only encrypts the values of encrypted keys using an encrypted_regex.
+  --dry-run        If updatekeys: Reports the SOPS files with outdated keys without writing them.
+  --rotate         If updatekeys: Also rotates the data key of every SOPS file.
+  --nest=<sep>     If --out=json, yaml or toml: Nests keys split by <sep>arator,
+                   a <sep> of "." outputs db.host as {"db": {"host": ...}}.
   
   --export, -x     If --out=dotenv: Prepends "export " to each line.
-  --preserve, -p   If --out=dotenv: Preserves variable casing.
+  --preserve, -p   If --out=dotenv, compose, shell, github or gitlab: Preserves variable casing.
   --sep=<sep>      If --out=raw:    Delimits values with a <sep>arator.
+                   If --out=ini:    Groups keys into sections by <sep>arator, defaults to ".".
+  --name=<name>    If --out=k8s:    Names the ConfigMap and Secret, defaults to <ctx>.
+  --namespace=<ns>  If --out=k8s:   Sets the namespace of the ConfigMap and Secret.
+  --compose=<file>  If --out=compose: Patches the environment of --service in a compose file.
+  --service=<svc>  If --out=compose: The compose service to patch.
+  --shell=<sh>     If --out=shell:  The shell syntax to output: sh, fish or pwsh, defaults to sh.
+  --unset, -u      If --out=shell:  Outputs a script that unsets every key instead.
+  --github=<file>  If --out=github: Appends to $GITHUB_ENV for "env" or $GITHUB_OUTPUT for "output"
+                   instead of stdout, ::add-mask:: commands for encrypted values are always written to stdout.
  `
 
 // Conf is used to bind CLI arguments and options
 type Conf struct {
-	Gen       bool
-	Ctx       string
-	File      string `docopt:"<cog-file>"`
-	Output    string `docopt:"--out"`
-	Keys      string
-	Not       string
-	NoEnc     bool
-	NoDecrypt bool
-	Raw       bool
-	EnvSubst  bool `docopt:"--envsubst"`
-	Export    bool
-	Preserve  bool
-	Delimiter string `docopt:"--sep"`
+	Gen        bool
+	Render     bool
+	Template   string `docopt:"--template"`
+	Set        bool
+	UpdateKeys bool `docopt:"updatekeys"`
+	Lint       bool
+	DryRun     bool `docopt:"--dry-run"`
+	Rotate     bool
+	Key        string `docopt:"<key>"`
+	Value      string `docopt:"<value>"`
+	Ctx        string
+	All        bool
+	File       string `docopt:"<cog-file>"`
+	Output     string `docopt:"--out"`
+	Keys       string
+	Not        string
+	NoEnc      bool
+	NoDecrypt  bool
+	Redact     bool
+	RedactHash bool   `docopt:"--redact-hash"`
+	AgeKeyFile string `docopt:"--age-key-file"`
+	GnuPGHome  string `docopt:"--gnupg-home"`
+	KeyTypes   string `docopt:"--key-types"`
+	KeyService string `docopt:"--keyservice"`
+	AuditLog   string `docopt:"--audit-log"`
+	Raw        bool
+	Sort       bool
+	Nest       string
+	EnvSubst   bool `docopt:"--envsubst"`
+	Export     bool
+	Preserve   bool
+	Delimiter  string `docopt:"--sep"`
+	Name       string `docopt:"--name"`
+	Namespace  string `docopt:"--namespace"`
+	Compose    string `docopt:"--compose"`
+	Service    string `docopt:"--service"`
+	Shell      string `docopt:"--shell"`
+	Unset      bool
+	Write      bool
+	Check      bool
+	EncryptOut bool   `docopt:"--encrypt-out"`
+	PGP        string `docopt:"--pgp"`
+	Age        string `docopt:"--age"`
+	EncOnly    bool   `docopt:"--enc-only"`
+	GitHub     string `docopt:"--github"`
 }
 
 var conf Conf
@@ -85,10 +159,51 @@ func run() error {
 	if cogs.NoDecrypt && cogs.NoEnc {
 		return cogs.ErrNoEncAndNoDecrypt
 	}
+	cogs.DecryptKeys = cogs.KeyConfig{AgeKeyFile: conf.AgeKeyFile, GnuPGHome: conf.GnuPGHome}
+	if conf.KeyTypes != "" {
+		cogs.DecryptKeys.KeyTypes = strings.Split(conf.KeyTypes, ",")
+	}
+	if err := cogs.DecryptKeys.Validate(); err != nil {
+		return fmt.Errorf("invalid opt: --key-types: %w", err)
+	}
+	if conf.KeyService != "" {
+		cogs.DecryptKeys.KeyServices = strings.Split(conf.KeyService, ",")
+	}
+	if err := cogs.DecryptKeys.ValidateKeyServices(); err != nil {
+		return fmt.Errorf("invalid opt: --keyservice: %w", err)
+	}
+
+	switch conf.AuditLog {
+	case "":
+	case "-":
+		cogs.AuditLog = os.Stderr
+	default:
+		f, err := os.OpenFile(conf.AuditLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return fmt.Errorf("invalid opt: --audit-log: %w", err)
+		}
+		defer f.Close()
+		cogs.AuditLog = f
+	}
+
+	switch {
+	case conf.RedactHash:
+		cogs.Redact = cogs.RedactHash
+		cogs.RedactKey = []byte(os.Getenv("COGS_REDACT_KEY"))
+	case conf.Redact:
+		cogs.Redact = cogs.RedactMask
+	}
 
 	switch {
+	case conf.UpdateKeys:
+		return updateKeys()
+	case conf.Lint:
+		return lint()
+	case conf.Set:
+		return cogs.Set(conf.Ctx, conf.File, conf.Key, conf.Value)
+	case conf.Render:
+		return cogs.Render(conf.Ctx, conf.File, conf.Template, conf.filterLinks, os.Stdout)
 	case conf.Gen:
-		var b []byte
 		var output string
 
 		format, err := conf.validate()
@@ -96,47 +211,181 @@ func run() error {
 			return err
 		}
 
-		cfgMap, err := cogs.Generate(conf.Ctx, conf.File, format, conf.filterLinks)
-		if err != nil {
-			return err
+		if conf.Write || conf.Check {
+			return writeOutputs(conf.Check)
 		}
 
-		switch format {
-		case cogs.JSON:
-			b, err = json.MarshalIndent(cfgMap, "", "  ")
-			output = string(b) + "\n"
-		case cogs.YAML:
-			b, err = yaml.Marshal(cfgMap)
-			output = string(b)
-		case cogs.TOML:
-			b, err = toml.Marshal(cfgMap)
-			output = string(b)
-		case cogs.Dotenv:
-			var modFn []func(string) string
-			// if --preserve was called, do not convert variable names to uppercase
-			if !conf.Preserve {
-				modFn = append(modFn, strings.ToUpper)
-			}
-			// if --export was called, prepend "export " to key name
-			if conf.Export {
-				modFn = append(modFn, func(k string) string { return "export " + k })
+		// multiple contexts are output as an object keyed by context name
+		if conf.multiCtx() {
+			if output, err = genAll(format); err != nil {
+				return err
 			}
-			// convert all key values to uppercase
-			output, err = godotenv.Marshal(modKeys(cfgMap, modFn...))
-			output = output + "\n"
-		case cogs.Raw:
-			keyList := []string{}
-			if conf.Keys != "" {
-				keyList = strings.Split(conf.Keys, ",")
-			}
-			output, err = getRawValue(cfgMap, keyList, conf.Delimiter)
+			fmt.Fprint(os.Stdout, output)
+			return nil
 		}
+
+		cfg, err := cogs.GenerateConfig(conf.Ctx, conf.File, format, conf.filterLinks)
 		if err != nil {
 			return err
 		}
+		output, err = conf.marshal(cfg, format)
+		if err != nil {
+			return err
+		}
+		if output, err = conf.encrypt(output, format, conf.File, cfg); err != nil {
+			return err
+		}
 
 		fmt.Fprint(os.Stdout, output)
 	}
 
 	return nil
 }
+
+// marshal serializes a Config using the given format and the output options of c,
+// formats that write to a file rather than stdout return an empty string
+func (c *Conf) marshal(cfg *cogs.Config, format cogs.Format) (output string, err error) {
+	var b []byte
+	if c.Sort {
+		cfg.Sort()
+	}
+	if c.Nest != "" {
+		if cfg, err = cfg.Nest(c.Nest); err != nil {
+			return "", err
+		}
+	}
+
+	switch format {
+	case cogs.JSON:
+		b, err = json.MarshalIndent(cfg, "", "  ")
+		output = string(b) + "\n"
+	case cogs.YAML:
+		b, err = yaml.Marshal(cfg)
+		output = string(b)
+	case cogs.TOML:
+		b, err = toml.Marshal(cfg)
+		output = string(b)
+	case cogs.Dotenv:
+		var modFn []func(string) string
+		// if --preserve was called, do not convert variable names to uppercase
+		if !c.Preserve {
+			modFn = append(modFn, strings.ToUpper)
+		}
+		// if --export was called, prepend "export " to key name
+		if c.Export {
+			modFn = append(modFn, func(k string) string { return "export " + k })
+		}
+		// convert all key values to uppercase
+		output, err = getDotenv(cfg.ModKeys(modFn...))
+		output = output + "\n"
+	case cogs.Raw:
+		keyList := []string{}
+		if c.Keys != "" {
+			keyList = strings.Split(c.Keys, ",")
+		}
+		output, err = getRawValue(cfg, keyList, c.Delimiter)
+	case cogs.K8s:
+		name := c.Name
+		if name == "" {
+			name = c.Ctx
+		}
+		b, err = cogs.MarshalK8s(cfg, name, c.Namespace)
+		output = string(b)
+	case cogs.Compose:
+		if !c.Preserve {
+			cfg = cfg.ModKeys(strings.ToUpper)
+		}
+		// patch the compose file in place rather than writing to stdout
+		if c.Compose != "" {
+			return "", patchCompose(cfg)
+		}
+		b, err = cogs.MarshalCompose(cfg)
+		output = string(b)
+	case cogs.Properties:
+		b, err = cogs.MarshalProperties(cfg)
+		output = string(b)
+	case cogs.INI:
+		b, err = cogs.MarshalINI(cfg, c.Delimiter)
+		output = string(b)
+	case cogs.Tfvars:
+		b, err = cogs.MarshalTfvars(cfg)
+		output = string(b)
+	case cogs.GitHub:
+		if !c.Preserve {
+			cfg = cfg.ModKeys(strings.ToUpper)
+		}
+		// encrypted values must be masked before they are written anywhere,
+		// including outputs that are written to files with --write
+		if b, err = cogs.GitHubMasks(cfg); err != nil {
+			return "", err
+		}
+		fmt.Fprint(os.Stdout, string(b))
+		if b, err = cogs.MarshalGitHub(cfg); err != nil {
+			return "", err
+		}
+		if c.GitHub != "" {
+			return "", writeGitHub(b)
+		}
+		output = string(b)
+	case cogs.GitLab:
+		if !c.Preserve {
+			cfg = cfg.ModKeys(strings.ToUpper)
+		}
+		b, err = cogs.MarshalGitLab(cfg)
+		output = string(b)
+	case cogs.Shell:
+		if !c.Preserve {
+			cfg = cfg.ModKeys(strings.ToUpper)
+		}
+		sh := cogs.Sh
+		if c.Shell != "" {
+			sh = cogs.ShellDialect(c.Shell)
+		}
+		if c.Unset {
+			b, err = cogs.MarshalShellUnset(cfg, sh)
+		} else {
+			b, err = cogs.MarshalShell(cfg, sh)
+		}
+		output = string(b)
+	}
+	return output, err
+}
+
+// genAll resolves every context matching --all or a <ctx> glob pattern
+func genAll(format cogs.Format) (string, error) {
+	var ctxNames []string
+	if !conf.All {
+		ctxNames = []string{conf.Ctx}
+	}
+	cfgs, err := cogs.GenerateAll(conf.File, format, conf.filterLinks, ctxNames...)
+	if err != nil {
+		return "", err
+	}
+	for ctxName, cfg := range cfgs {
+		if conf.Sort {
+			cfg.Sort()
+		}
+		if conf.Nest != "" {
+			if cfgs[ctxName], err = cfg.Nest(conf.Nest); err != nil {
+				return "", fmt.Errorf("%s: %w", ctxName, err)
+			}
+		}
+	}
+
+	var b []byte
+	switch format {
+	case cogs.JSON:
+		b, err = json.MarshalIndent(cfgs, "", "  ")
+		b = append(b, '\n')
+	case cogs.YAML:
+		b, err = yaml.Marshal(cfgs)
+	}
+	if err != nil {
+		return "", err
+	}
+	var cfgList []*cogs.Config
+	for _, cfg := range cfgs {
+		cfgList = append(cfgList, cfg)
+	}
+	return conf.encrypt(string(b), format, conf.File, cfgList...)
+}
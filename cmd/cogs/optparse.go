@@ -1,9 +1,16 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+
 	"github.com/Bestowinc/cogs"
 )
 
@@ -11,7 +18,7 @@ import (
 // CLI optparse functions
 // ----------------------
 
-func getRawValue(cfgMap cogs.CfgMap, keyList []string, delimiter string) (string, error) {
+func getRawValue(cfg *cogs.Config, keyList []string, delimiter string) (string, error) {
 	var values []string
 	// Interpret --sep='\n' and --sep='\t' as newlines and tabs
 	switch delimiter {
@@ -22,33 +29,35 @@ func getRawValue(cfgMap cogs.CfgMap, keyList []string, delimiter string) (string
 	}
 	if len(keyList) != 0 {
 		for _, v := range keyList {
-			keyName, ok := cfgMap[v]
+			keyName, ok := cfg.Values[v]
 			if !ok {
 				return "", fmt.Errorf("getRawValue: key %s is missing from cfgMap", v)
 			}
 			values = append(values, fmt.Sprintf("%s", keyName))
 		}
 	} else {
-		// iterate without an order reference if keyList is empty
-		for _, v := range cfgMap {
-			values = append(values, fmt.Sprintf("%s", v))
+		// retain the Config key order if keyList is empty
+		for _, k := range cfg.Keys {
+			values = append(values, fmt.Sprintf("%s", cfg.Values[k]))
 		}
 	}
 	return strings.Join(values, delimiter), nil
 
 }
 
-// modKeys should always return a flat associative array of strings
+// getDotenv should always return a flat list of dotenv lines in Config key order,
 // coercing any interface{} value into a string
-func modKeys(cfgMap cogs.CfgMap, modFn ...func(string) string) map[string]string {
-	newCfgMap := make(map[string]string)
-	for k, v := range cfgMap {
-		for _, fn := range modFn {
-			k = fn(k)
+func getDotenv(cfg *cogs.Config) (string, error) {
+	var lines []string
+	for _, k := range cfg.Keys {
+		// marshal each line separately since godotenv.Marshal sorts its output
+		line, err := godotenv.Marshal(map[string]string{k: fmt.Sprintf("%s", cfg.Values[k])})
+		if err != nil {
+			return "", err
 		}
-		newCfgMap[k] = fmt.Sprintf("%s", v)
+		lines = append(lines, line)
 	}
-	return newCfgMap
+	return strings.Join(lines, "\n"), nil
 }
 
 // filterLinks retains only key names passed to --keys
@@ -91,22 +100,373 @@ func (c *Conf) validate() (format cogs.Format, err error) {
 	if !c.Gen {
 		return "", nil
 	}
-	if format = cogs.Format(conf.Output); format.Validate() != nil {
-		return "", fmt.Errorf("invalid opt: --out %s", conf.Output)
+	if format = cogs.Format(c.Output); format.Validate() != nil {
+		return "", fmt.Errorf("invalid opt: --out %s", c.Output)
+	}
+	if err := c.validateFormat(format); err != nil {
+		return "", err
+	}
+	if c.DryRun || c.Rotate {
+		return "", fmt.Errorf("invalid opt: --dry-run and --rotate require cogs updatekeys")
+	}
+	if !c.EncryptOut && (c.PGP != "" || c.Age != "" || c.EncOnly) {
+		return "", fmt.Errorf("invalid opt: --pgp, --age and --enc-only require --encrypt-out")
+	}
+	if c.EncryptOut && c.Check {
+		return "", fmt.Errorf("invalid opt: --encrypt-out can not be used with --check, encrypted outputs differ on every run")
+	}
+	if c.Write && c.Check {
+		return "", fmt.Errorf("invalid opt: --write and --check can not be used together")
+	}
+	if (c.Write || c.Check) && (c.Redact || c.RedactHash) {
+		return "", fmt.Errorf("invalid opt: --redact can not be used with --write or --check")
+	}
+	if (c.Write || c.Check) && c.multiCtx() {
+		return "", fmt.Errorf("invalid opt: --write and --check require a single <ctx>")
+	}
+	if c.GitHub != "" && c.GitHub != "env" && c.GitHub != "output" {
+		return "", fmt.Errorf("invalid opt: --github %s: must be env or output", c.GitHub)
+	}
+	if (c.Compose == "") != (c.Service == "") {
+		return "", fmt.Errorf("invalid opt: --compose and --service must be used together")
+	}
+	return format, nil
+}
+
+// validateFormat ensures that the output options of c can be used with format,
+// this is run for --out and for every output declared under [<ctx>.outputs]
+func (c *Conf) validateFormat(format cogs.Format) error {
+	if c.multiCtx() && format != cogs.JSON && format != cogs.YAML {
+		return fmt.Errorf("invalid opt: --out %s: multiple contexts can only be output as json or yaml", format)
+	}
+	if c.Nest != "" && format != cogs.JSON && format != cogs.YAML && format != cogs.TOML {
+		return fmt.Errorf("invalid opt: --nest requires --out=json, yaml or toml")
+	}
+	if format != cogs.K8s && (c.Name != "" || c.Namespace != "") {
+		return fmt.Errorf("invalid opt: --name and --namespace require --out=k8s")
+	}
+	if format != cogs.Compose && (c.Compose != "" || c.Service != "") {
+		return fmt.Errorf("invalid opt: --compose and --service require --out=compose")
+	}
+	if format != cogs.Shell && (c.Shell != "" || c.Unset) {
+		return fmt.Errorf("invalid opt: --shell and --unset require --out=shell")
+	}
+	if err := cogs.ShellDialect(c.Shell).Validate(); c.Shell != "" && err != nil {
+		return fmt.Errorf("invalid opt: --shell %s", c.Shell)
+	}
+	if c.EncryptOut && !c.Write && format != cogs.JSON && format != cogs.YAML && format != cogs.Dotenv {
+		return fmt.Errorf("invalid opt: --encrypt-out requires --out=json, yaml or dotenv")
+	}
+	if format != cogs.GitHub && c.GitHub != "" {
+		return fmt.Errorf("invalid opt: --github requires --out=github")
 	}
 
 	switch {
-	case format != cogs.Raw:
+	case format != cogs.Raw && format != cogs.INI:
 		if c.Delimiter != "" {
-			return "", fmt.Errorf("invalid opt: --sep")
+			return fmt.Errorf("invalid opt: --sep")
 		}
 	case format != cogs.Dotenv:
 		if c.Export {
-			return "", fmt.Errorf("invalid opt: --export")
+			return fmt.Errorf("invalid opt: --export")
 		}
 		if c.Preserve {
-			return "", fmt.Errorf("invalid opt: --preserve")
+			return fmt.Errorf("invalid opt: --preserve")
 		}
 	}
-	return format, nil
+	return nil
+}
+
+// multiCtx returns true if --all was called or <ctx> is a glob pattern
+func (c *Conf) multiCtx() bool {
+	return c.All || cogs.IsPattern(c.Ctx)
+}
+
+// patchCompose writes the environment of a Config to the --service of the --compose file
+func patchCompose(cfg *cogs.Config) error {
+	info, err := os.Stat(conf.Compose)
+	if err != nil {
+		return err
+	}
+	b, err := os.ReadFile(conf.Compose)
+	if err != nil {
+		return err
+	}
+	if b, err = cogs.PatchCompose(b, conf.Service, cfg); err != nil {
+		return err
+	}
+	return os.WriteFile(conf.Compose, b, info.Mode())
+}
+
+// writeGitHub appends GitHub Actions file commands to the file named by $GITHUB_ENV or $GITHUB_OUTPUT
+func writeGitHub(b []byte) error {
+	envName := "GITHUB_" + strings.ToUpper(conf.GitHub)
+	filePath := os.Getenv(envName)
+	if filePath == "" {
+		return fmt.Errorf("--github=%s: $%s is not set", conf.GitHub, envName)
+	}
+	f, err := os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeOutputs generates every output declared under [<ctx>.outputs],
+// files are only replaced once every output has been generated successfully.
+// If check is true, no files are written and an error lists the outputs that are stale
+func writeOutputs(check bool) error {
+	outputs, err := cogs.Outputs(conf.Ctx, conf.File)
+	if err != nil {
+		return err
+	}
+	if len(outputs) == 0 {
+		return fmt.Errorf("%s: no outputs are declared under [%s.outputs]", conf.File, conf.Ctx)
+	}
+
+	outConfs := make([]*Conf, len(outputs))
+	for i, out := range outputs {
+		outConfs[i] = &Conf{
+			Ctx:       conf.Ctx,
+			Keys:      strings.Join(out.Keys, ","),
+			Not:       strings.Join(out.Not, ","),
+			NoEnc:     conf.NoEnc,
+			Sort:      out.Sort,
+			Nest:      out.Nest,
+			Export:    out.Export,
+			Preserve:  out.Preserve,
+			Delimiter: out.Sep,
+			Name:      out.K8sName,
+			Namespace: out.Namespace,
+			Shell:     out.Shell,
+			// encrypt every output in the same manner
+			EncryptOut: conf.EncryptOut,
+			PGP:        conf.PGP,
+			Age:        conf.Age,
+			EncOnly:    conf.EncOnly,
+		}
+		if err := outConfs[i].validateFormat(out.Format); err != nil {
+			return fmt.Errorf("%s.outputs.%s: %w", conf.Ctx, out.Name, err)
+		}
+	}
+
+	// the context is generated once with the keys of every output,
+	// so that its encrypted paths are only decrypted and audited once
+	outKeys := make([][]string, len(outputs))
+	filter := func(linkMap cogs.LinkMap) (cogs.LinkMap, error) {
+		union := make(cogs.LinkMap)
+		for i, out := range outputs {
+			filtered, err := outConfs[i].filterLinks(linkMap)
+			if err != nil {
+				return nil, fmt.Errorf("%s.outputs.%s: %w", conf.Ctx, out.Name, err)
+			}
+			for k, link := range filtered {
+				union[k] = link
+				outKeys[i] = append(outKeys[i], k)
+			}
+		}
+		return union, nil
+	}
+	cfg, err := cogs.GenerateConfig(conf.Ctx, conf.File, cogs.JSON, filter)
+	if err != nil {
+		return err
+	}
+
+	contents := make([][]byte, len(outputs))
+	for i, out := range outputs {
+		outCfg, err := cfg.Filter(outKeys[i]).Convert(out.Format)
+		if err != nil {
+			return fmt.Errorf("%s.outputs.%s: %w", conf.Ctx, out.Name, err)
+		}
+		output, err := outConfs[i].marshal(outCfg, out.Format)
+		if err != nil {
+			return fmt.Errorf("%s.outputs.%s: %w", conf.Ctx, out.Name, err)
+		}
+		if output, err = outConfs[i].encrypt(output, out.Format, out.File, outCfg); err != nil {
+			return fmt.Errorf("%s.outputs.%s: %w", conf.Ctx, out.Name, err)
+		}
+		contents[i] = []byte(output)
+	}
+
+	if check {
+		var stale []string
+		for i, out := range outputs {
+			b, err := os.ReadFile(out.File)
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			if err != nil || !bytes.Equal(b, contents[i]) {
+				stale = append(stale, out.File)
+			}
+		}
+		if len(stale) > 0 {
+			return fmt.Errorf("stale outputs, run with --write to update:\n      %s", strings.Join(stale, "\n      "))
+		}
+		return nil
+	}
+
+	// write every output to a temporary file before renaming any of them into place
+	tmpFiles := make([]string, len(outputs))
+	defer func() {
+		for _, tmpFile := range tmpFiles {
+			if tmpFile != "" {
+				os.Remove(tmpFile)
+			}
+		}
+	}()
+	for i, out := range outputs {
+		if tmpFiles[i], err = writeTemp(out.File, contents[i]); err != nil {
+			return err
+		}
+	}
+	for i, out := range outputs {
+		if err := os.Rename(tmpFiles[i], out.File); err != nil {
+			return err
+		}
+		tmpFiles[i] = ""
+	}
+	return nil
+}
+
+// writeTemp writes b to a temporary file in the directory of filePath,
+// retaining the mode of filePath if it exists
+func writeTemp(filePath string, b []byte) (string, error) {
+	dir := filepath.Dir(filePath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	f, err := os.CreateTemp(dir, "."+filepath.Base(filePath)+".*")
+	if err != nil {
+		return "", err
+	}
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(filePath); err == nil {
+		mode = info.Mode()
+	}
+	if _, err = f.Write(b); err == nil {
+		err = f.Chmod(mode)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// updateKeys syncs the master keys of every SOPS file referenced by --all or a <ctx> glob pattern
+// and prints which files changed
+func updateKeys() error {
+	var ctxNames []string
+	if !conf.All {
+		ctxNames = []string{conf.Ctx}
+	}
+	updates, err := cogs.UpdateKeys(conf.File, conf.DryRun, conf.Rotate, ctxNames...)
+	for _, update := range updates {
+		status := "up to date"
+		switch {
+		case update.Changed() && conf.DryRun:
+			status = "would be updated"
+		case update.Changed():
+			status = "updated"
+		}
+		fmt.Printf("%s: %s\n", update.Path, status)
+		for _, key := range update.Added {
+			fmt.Printf("    + %s\n", key)
+		}
+		for _, key := range update.Removed {
+			fmt.Printf("    - %s\n", key)
+		}
+		if update.ShamirThreshold != 0 {
+			fmt.Printf("    shamir_threshold = %d\n", update.ShamirThreshold)
+		}
+	}
+	return err
+}
+
+// lint outputs every likely secret found in the plaintext sources of the cog file as JSON or YAML,
+// failing if any were found
+func lint() error {
+	var ctxNames []string
+	if !conf.All {
+		ctxNames = []string{conf.Ctx}
+	}
+	format := cogs.Format(conf.Output)
+	if format != cogs.JSON && format != cogs.YAML {
+		return fmt.Errorf("invalid opt: --out %s: lint findings can only be output as json or yaml", conf.Output)
+	}
+	// contexts that could not be resolved are reported after the findings of every other context
+	findings, resolveErr := cogs.Lint(conf.File, ctxNames...)
+	if findings == nil && resolveErr != nil {
+		return resolveErr
+	}
+	if findings == nil {
+		findings = []*cogs.Finding{}
+	}
+	var b []byte
+	var err error
+	switch format {
+	case cogs.JSON:
+		b, err = json.MarshalIndent(findings, "", "  ")
+		b = append(b, '\n')
+	case cogs.YAML:
+		b, err = yaml.Marshal(findings)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(os.Stdout, string(b))
+	switch {
+	case len(findings) > 0 && resolveErr != nil:
+		return fmt.Errorf("%d likely secrets found in plaintext sources\n%w", len(findings), resolveErr)
+	case len(findings) > 0:
+		return fmt.Errorf("%d likely secrets found in plaintext sources", len(findings))
+	}
+	return nil
+}
+
+// encrypt encrypts an output with SOPS if --encrypt-out was passed,
+// using the .sops.yaml creation rule for path unless --pgp or --age recipients are given
+func (c *Conf) encrypt(output string, format cogs.Format, path string, cfgs ...*cogs.Config) (string, error) {
+	if !c.EncryptOut {
+		return output, nil
+	}
+	if c.Export {
+		return "", fmt.Errorf("dotenv output using export can not be encrypted")
+	}
+	opts := cogs.EncryptOptions{Path: path}
+	if c.PGP != "" {
+		opts.PGP = strings.Split(c.PGP, ",")
+	}
+	if c.Age != "" {
+		opts.Age = strings.Split(c.Age, ",")
+	}
+	if c.EncOnly {
+		opts.Keys = []string{}
+		for _, cfg := range cfgs {
+			for _, k := range cfg.Keys {
+				if !cfg.Encrypted(k) {
+					continue
+				}
+				// match the key names as they are output, nested keys are matched by their last name
+				// so any plaintext key sharing that name is encrypted as well
+				if c.Nest != "" {
+					parts := strings.Split(k, c.Nest)
+					k = parts[len(parts)-1]
+				}
+				if format == cogs.Dotenv && !c.Preserve {
+					k = strings.ToUpper(k)
+				}
+				opts.Keys = append(opts.Keys, k)
+			}
+		}
+	}
+	b, err := cogs.EncryptOutput([]byte(output), format, opts)
+	return string(b), err
 }
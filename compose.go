@@ -0,0 +1,351 @@
+package cogs
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MarshalCompose serializes a Config as a docker-compose environment block
+// using the list form that NewDotenvVisitor is able to read back in:
+//
+//	environment:
+//	  - KEY=value
+//
+// The Config should be generated using the Compose Format so that every value is a string,
+// a "$" within a value is escaped as "$$"
+func MarshalCompose(cfg *Config) ([]byte, error) {
+	values, err := composeValues(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("MarshalCompose: %w", err)
+	}
+	env := &yaml.Node{Kind: yaml.SequenceNode}
+	for _, k := range cfg.Keys {
+		env.Content = append(env.Content, strNode(k+"="+values[k]))
+	}
+	return marshalYAMLIndent(&yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{strNode("environment"), env}}, 2)
+}
+
+// PatchCompose sets the environment of a service in a docker-compose file to the values of a Config,
+// splicing the entries of its environment block into the file so that the rest of the file is kept as is.
+// Existing environment entries for keys that are not part of the Config are kept, and the
+// existing map or list form of the environment block is retained
+func PatchCompose(composeFile []byte, service string, cfg *Config) ([]byte, error) {
+	doc := &yaml.Node{}
+	if err := yaml.Unmarshal(composeFile, doc); err != nil {
+		return nil, fmt.Errorf("PatchCompose: %w", err)
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 {
+		return nil, fmt.Errorf("PatchCompose: compose file is empty")
+	}
+
+	services := mappingValue(doc.Content[0], "services")
+	if services == nil || services.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("PatchCompose: compose file does not define any services")
+	}
+	serviceNode := mappingValue(services, service)
+	if serviceNode == nil || serviceNode.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("PatchCompose: service %q is not defined in compose file", service)
+	}
+
+	values, err := composeValues(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("PatchCompose: %s: %w", service, err)
+	}
+	b, err := patchComposeEnv(composeFile, doc, serviceNode, cfg.Keys, values)
+	if err != nil {
+		return nil, fmt.Errorf("PatchCompose: %s: %w", service, err)
+	}
+	return b, nil
+}
+
+// yamlEdit replaces the bytes of a YAML document from start to end with text
+type yamlEdit struct {
+	start, end int
+	text       string
+}
+
+// patchComposeEnv splices the values of keys into the environment block of serviceNode,
+// replacing the value of existing entries and adding new entries after the last entry
+func patchComposeEnv(b []byte, doc, serviceNode *yaml.Node, keys []string, values map[string]string) ([]byte, error) {
+	var envKey, env *yaml.Node
+	for i := 0; i+1 < len(serviceNode.Content); i += 2 {
+		if serviceNode.Content[i].Value == "environment" {
+			envKey, env = serviceNode.Content[i], serviceNode.Content[i+1]
+		}
+	}
+	indent := strings.Repeat(" ", detectIndent(b))
+
+	var edits []yamlEdit
+	set := make(map[string]bool)
+	switch {
+	case env == nil:
+		if serviceNode.Style&yaml.FlowStyle != 0 || len(serviceNode.Content) == 0 {
+			return nil, fmt.Errorf("environment can not be added to a flow style service")
+		}
+		prefix := strings.Repeat(" ", serviceNode.Content[0].Column-1)
+		entries, err := composeEntries(keys, values, set, false, false)
+		if err != nil {
+			return nil, err
+		}
+		end := yamlBlockEnd(b, doc, serviceNode)
+		edits = append(edits, yamlEdit{end, end, prefix + "environment:\n" + blockEntries(entries, prefix+indent+"- ")})
+	// an environment key without a value is treated as an empty list
+	case env.Kind == yaml.ScalarNode && env.Tag == "!!null":
+		if env.Value != "" {
+			start, end, err := yamlScalarRange(b, env, false)
+			if err != nil {
+				return nil, err
+			}
+			for start > 0 && (b[start-1] == ' ' || b[start-1] == '\t') {
+				start--
+			}
+			edits = append(edits, yamlEdit{start: start, end: end})
+		}
+		entries, err := composeEntries(keys, values, set, false, false)
+		if err != nil {
+			return nil, err
+		}
+		lineEnd := len(b)
+		if i := bytes.IndexByte(b[yamlOffset(b, envKey.Line, envKey.Column):], '\n'); i >= 0 {
+			lineEnd = yamlOffset(b, envKey.Line, envKey.Column) + i + 1
+		}
+		prefix := strings.Repeat(" ", envKey.Column-1) + indent + "- "
+		edits = append(edits, yamlEdit{lineEnd, lineEnd, blockEntries(entries, prefix)})
+	case env.Kind == yaml.MappingNode || env.Kind == yaml.SequenceNode:
+		mapping, flow := env.Kind == yaml.MappingNode, env.Style&yaml.FlowStyle != 0
+		var last *yaml.Node
+		// list entries are KEY=value strings while map entries are key and value nodes
+		for i := 0; i < len(env.Content); i++ {
+			entry, valueNode := env.Content[i], env.Content[i]
+			k, _, _ := strings.Cut(entry.Value, "=")
+			if mapping {
+				i++
+				k, valueNode = entry.Value, env.Content[i]
+			}
+			last = entry
+			v, ok := values[k]
+			if !ok {
+				continue
+			}
+			set[k] = true
+			edit, err := spliceComposeEntry(b, valueNode, k, v, mapping, flow)
+			if err != nil {
+				return nil, err
+			}
+			edits = append(edits, edit)
+		}
+
+		// new entries follow the last entry in the same form
+		entries, err := composeEntries(keys, values, set, mapping, flow)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case len(entries) == 0:
+		case flow && last == nil:
+			start := yamlOffset(b, env.Line, env.Column) + 1
+			edits = append(edits, yamlEdit{start, start, strings.Join(entries, ", ")})
+		case flow:
+			_, end, err := yamlScalarRange(b, env.Content[len(env.Content)-1], true)
+			if err != nil {
+				return nil, err
+			}
+			edits = append(edits, yamlEdit{end, end, ", " + strings.Join(entries, ", ")})
+		default:
+			offset := yamlOffset(b, last.Line, last.Column)
+			lineStart := bytes.LastIndexByte(b[:offset], '\n') + 1
+			end := yamlBlockEnd(b, doc, env)
+			edits = append(edits, yamlEdit{end, end, blockEntries(entries, string(b[lineStart:offset]))})
+		}
+	default:
+		return nil, fmt.Errorf("environment must be a map or a list")
+	}
+
+	// splice the edits from the end of the file so that the offsets of earlier edits remain valid
+	sort.Slice(edits, func(i, j int) bool { return edits[i].start > edits[j].start })
+	out := append([]byte{}, b...)
+	for _, edit := range edits {
+		// lines appended to a file without a trailing line break start on a new line
+		if edit.start == len(b) && len(b) > 0 && b[len(b)-1] != '\n' && strings.HasSuffix(edit.text, "\n") {
+			edit.text = "\n" + edit.text
+		}
+		out = append(out[:edit.start], append([]byte(edit.text), out[edit.end:]...)...)
+	}
+	return out, nil
+}
+
+// spliceComposeEntry returns the edit replacing the value of an existing environment entry
+func spliceComposeEntry(b []byte, valueNode *yaml.Node, k, v string, mapping, flow bool) (yamlEdit, error) {
+	if valueNode.Kind != yaml.ScalarNode {
+		return yamlEdit{}, fmt.Errorf("%s: environment values must be strings", k)
+	}
+	if !mapping {
+		start, end, err := yamlScalarRange(b, valueNode, flow)
+		if err != nil {
+			return yamlEdit{}, fmt.Errorf("%s: %w", k, err)
+		}
+		item, err := yamlScalar(valueNode, k+"="+v, flow)
+		return yamlEdit{start, end, string(item)}, err
+	}
+
+	// a key without a value is given one where its empty value is positioned
+	if valueNode.Tag == "!!null" && valueNode.Value == "" {
+		value, err := yamlScalar(&yaml.Node{Tag: "!!str"}, v, flow)
+		offset := yamlOffset(b, valueNode.Line, valueNode.Column)
+		if offset == 0 || b[offset-1] != ' ' {
+			value = append([]byte(" "), value...)
+		}
+		return yamlEdit{offset, offset, string(value)}, err
+	}
+	start, end, err := yamlScalarRange(b, valueNode, flow)
+	if err != nil {
+		return yamlEdit{}, fmt.Errorf("%s: %w", k, err)
+	}
+	// values are only left unquoted if they resolve to the same type as the existing value
+	node := *valueNode
+	if (&yaml.Node{Kind: yaml.ScalarNode, Value: v}).ShortTag() != valueNode.ShortTag() {
+		node.Tag = "!!str"
+	}
+	value, err := yamlScalar(&node, v, flow)
+	return yamlEdit{start, end, string(value)}, err
+}
+
+// composeEntries renders the keys that have not been set as environment entries
+func composeEntries(keys []string, values map[string]string, set map[string]bool, mapping, flow bool) ([]string, error) {
+	str := &yaml.Node{Tag: "!!str"}
+	var entries []string
+	for _, k := range keys {
+		if set[k] {
+			continue
+		}
+		if !mapping {
+			entry, err := yamlScalar(str, k+"="+values[k], flow)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, string(entry))
+			continue
+		}
+		key, err := yamlScalar(str, k, flow)
+		if err != nil {
+			return nil, err
+		}
+		value, err := yamlScalar(str, values[k], flow)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, string(key)+": "+string(value))
+	}
+	return entries, nil
+}
+
+// blockEntries returns each entry on its own line following prefix
+func blockEntries(entries []string, prefix string) string {
+	var sb strings.Builder
+	for _, entry := range entries {
+		sb.WriteString(prefix + entry + "\n")
+	}
+	return sb.String()
+}
+
+// yamlBlockEnd returns the offset following the last line of a block node,
+// trailing blank and comment lines are left to the node that follows it
+func yamlBlockEnd(b []byte, doc, node *yaml.Node) int {
+	last := lastLine(node)
+	next := nextLine(doc, node, last)
+	end := yamlOffset(b, last, 1)
+	for offset, line := end, last; offset < len(b) && (next == 0 || line < next); line++ {
+		lineEnd := len(b)
+		if i := bytes.IndexByte(b[offset:], '\n'); i >= 0 {
+			lineEnd = offset + i + 1
+		}
+		if content := bytes.TrimSpace(b[offset:lineEnd]); len(content) > 0 && content[0] != '#' {
+			end = lineEnd
+		}
+		offset = lineEnd
+	}
+	return end
+}
+
+// lastLine returns the last line of a node or any of its descendants
+func lastLine(node *yaml.Node) int {
+	line := node.Line
+	for _, n := range node.Content {
+		line = max(line, lastLine(n))
+	}
+	return line
+}
+
+// nextLine returns the first line after the given line holding a node of doc that is not within skip,
+// or 0 if there is none
+func nextLine(doc, skip *yaml.Node, after int) int {
+	if doc == skip {
+		return 0
+	}
+	next := 0
+	if doc.Line > after {
+		next = doc.Line
+	}
+	for _, n := range doc.Content {
+		if line := nextLine(n, skip, after); line != 0 && (next == 0 || line < next) {
+			next = line
+		}
+	}
+	return next
+}
+
+// composeValues returns the string values of a Config,
+// escaped so that a "$" is not interpolated by docker-compose
+func composeValues(cfg *Config) (map[string]string, error) {
+	values := make(map[string]string)
+	for _, k := range cfg.Keys {
+		v, err := SimpleValueToString(cfg.Values[k])
+		if err != nil {
+			return nil, err
+		}
+		// docker-compose interpolates $VAR within environment values
+		values[k] = strings.ReplaceAll(v, "$", "$$")
+	}
+	return values, nil
+}
+
+// mappingValue returns the value node for a given key in a mapping node
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+var indentRegexp = regexp.MustCompile(`(?m)^( +)\S`)
+
+// detectIndent returns the indentation width of the first indented line of a YAML document
+func detectIndent(b []byte) int {
+	if match := indentRegexp.FindSubmatch(b); match != nil {
+		return len(match[1])
+	}
+	return 2
+}
+
+func marshalYAMLIndent(v interface{}, indent int) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(indent)
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,177 @@
+package cogs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// DecodeTag is the struct tag used to map a resolved key name to a struct field:
+//
+//	type ServiceConfig struct {
+//		Port    int           `cogs:"port"`
+//		Timeout time.Duration `cogs:"timeout"`
+//		DB      DBConfig      `cogs:"db"`              // whole/json{} values can be decoded into nested structs
+//		Debug   bool          `cogs:"debug,optional"`  // optional fields can be missing from the context
+//	}
+const DecodeTag = "cogs"
+
+// GenerateInto resolves the given context and decodes the resulting values into v,
+// v must be a non-nil pointer to a struct
+func GenerateInto(ctxName, cogPath string, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("GenerateInto: expected a non-nil pointer to a struct, got %T", v)
+	}
+
+	cfg, err := GenerateConfig(ctxName, cogPath, JSON, nil)
+	if err != nil {
+		return err
+	}
+	return Decode(cfg, v)
+}
+
+// Decode maps the values of a Config onto the fields of the struct pointed to by v,
+// converting strings into durations, numbers and bools where needed,
+// any other type mismatch is reported in FieldsError.Invalid
+func Decode(cfg *Config, v interface{}) error {
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(
+			mapstructure.StringToTimeDurationHookFunc(),
+			mapstructure.TextUnmarshallerHookFunc(),
+			stringToBasicHookFunc(),
+			stringToComplexHookFunc(),
+		),
+		Result:  v,
+		TagName: DecodeTag,
+	})
+	if err != nil {
+		return err
+	}
+
+	fieldsErr := &FieldsError{}
+	missingFields(reflect.TypeOf(v), cfg.Values, "", &fieldsErr.Missing)
+	if err := decoder.Decode(map[string]interface{}(cfg.Values)); err != nil {
+		var mErr *mapstructure.Error
+		if !errors.As(err, &mErr) {
+			return err
+		}
+		fieldsErr.Invalid = mErr.Errors
+		sort.Strings(fieldsErr.Invalid)
+	}
+
+	if len(fieldsErr.Missing) > 0 || len(fieldsErr.Invalid) > 0 {
+		return fieldsErr
+	}
+	return nil
+}
+
+// missingFields records the required fields of struct type t that have no corresponding key in values,
+// nested fields are named using the dotted naming scheme that mapstructure uses
+func missingFields(t reflect.Type, values map[string]interface{}, prefix string, missing *[]string) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" { // unexported
+			continue
+		}
+		tagParts := strings.Split(field.Tag.Get(DecodeTag), ",")
+		if tagParts[0] == "-" {
+			continue
+		}
+		if InList("squash", tagParts[1:]) {
+			missingFields(field.Type, values, prefix, missing)
+			continue
+		}
+		key := field.Name
+		if tagParts[0] != "" {
+			key = tagParts[0]
+		}
+		name := key
+		if prefix != "" {
+			name = prefix + "." + key
+		}
+
+		value, ok := lookupFold(values, key)
+		if !ok {
+			if !InList("optional", tagParts[1:]) {
+				*missing = append(*missing, name)
+			}
+			continue
+		}
+		// only traverse nested values that have already been deserialized
+		if nested, ok := value.(map[string]interface{}); ok {
+			missingFields(field.Type, nested, name, missing)
+		}
+	}
+}
+
+// lookupFold retrieves a key from values, falling back to a case insensitive match
+// in the same manner as mapstructure
+func lookupFold(values map[string]interface{}, key string) (interface{}, bool) {
+	if v, ok := values[key]; ok {
+		return v, true
+	}
+	for k, v := range values {
+		if strings.EqualFold(k, key) {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// stringToBasicHookFunc parses strings, such as dotenv values, into numbers and bools,
+// empty strings are not treated as zero values
+func stringToBasicHookFunc() mapstructure.DecodeHookFuncType {
+	return func(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+		if f.Kind() != reflect.String {
+			return data, nil
+		}
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		str := data.(string)
+		switch t.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return strconv.ParseInt(str, 0, t.Bits())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return strconv.ParseUint(str, 0, t.Bits())
+		case reflect.Float32, reflect.Float64:
+			return strconv.ParseFloat(str, t.Bits())
+		case reflect.Bool:
+			return strconv.ParseBool(str)
+		}
+		return data, nil
+	}
+}
+
+// stringToComplexHookFunc allows serialized JSON strings to be decoded into structs and maps
+func stringToComplexHookFunc() mapstructure.DecodeHookFuncType {
+	return func(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+		if f.Kind() != reflect.String {
+			return data, nil
+		}
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct && t.Kind() != reflect.Map {
+			return data, nil
+		}
+		var i interface{}
+		if err := json.Unmarshal([]byte(data.(string)), &i); err != nil {
+			return nil, fmt.Errorf("unable to decode string as JSON: %w", err)
+		}
+		return i, nil
+	}
+}
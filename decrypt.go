@@ -2,24 +2,60 @@ package cogs
 
 import (
 	"net/http"
+	"regexp"
 
-	"github.com/getsops/sops/v3/decrypt"
+	"gopkg.in/yaml.v3"
 )
 
-func decryptFile(filePath string) ([]byte, error) {
+func decryptFile(filePath string, keys KeyConfig) ([]byte, error) {
 	encData, err := readFile(filePath)
 	if err != nil {
 		return nil, err
 	}
-	format := FormatForPath(filePath)
-	return decrypt.Data(encData, string(format))
+	return decryptData(filePath, encData, keys)
 }
 
-func decryptHTTPFile(urlPath string, header http.Header, method, body string) ([]byte, error) {
+func decryptHTTPFile(urlPath string, header http.Header, method, body string, keys KeyConfig) ([]byte, error) {
 	encData, err := getHTTPFile(urlPath, header, method, body)
 	if err != nil {
 		return nil, err
 	}
-	format := FormatForPath(urlPath)
-	return decrypt.Data(encData, string(format))
+	return decryptData(urlPath, encData, keys)
 }
+
+// decryptData decrypts SOPS encrypted data using the format derived from filePath
+// and the key material configured by keys
+func decryptData(filePath string, encData []byte, keys KeyConfig) ([]byte, error) {
+	f, err := decryptSOPS(filePath, encData, keys)
+	if err != nil {
+		return nil, err
+	}
+	return f.plaintext()
+}
+
+// isSOPSFile returns true if the data of a path holds SOPS metadata: a top-level sops key for YAML and JSON,
+// a [sops] section for INI, or sops_ prefixed keys for dotenv
+func isSOPSFile(filePath string, data []byte) bool {
+	switch FormatForPath(filePath) {
+	case YAML, JSON:
+		var doc struct {
+			Sops map[string]interface{} `yaml:"sops"`
+		}
+		// JSON is a subset of YAML
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return false
+		}
+		_, ok := doc.Sops["mac"]
+		return ok
+	case Dotenv:
+		return sopsDotenvRegexp.Match(data)
+	case INI:
+		return sopsINIRegexp.Match(data)
+	}
+	return false
+}
+
+var (
+	sopsDotenvRegexp = regexp.MustCompile(`(?m)^sops_mac=`)
+	sopsINIRegexp    = regexp.MustCompile(`(?m)^\[sops\]\s*$`)
+)
@@ -3,16 +3,27 @@
 go build -o ./tmp_cogs ./cmd/cogs
 ./tmp_cogs gen basic              ./examples/1.basic.cog.toml
 ./tmp_cogs gen basic              ./examples/1.basic.cog.toml --keys=var --out=toml
+./tmp_cogs gen basic              ./examples/1.basic.cog.toml --out=compose
+./tmp_cogs gen basic              ./examples/1.basic.cog.toml --out=shell --shell=fish
+./tmp_cogs render basic           ./examples/1.basic.cog.toml --template=./test_files/basic.conf.tmpl
 ./tmp_cogs gen get                ./examples/2.http.cog.toml
 ./tmp_cogs gen post               ./examples/2.http.cog.toml
 ./tmp_cogs gen post_multiple      ./examples/2.http.cog.toml
 ./tmp_cogs gen sops               ./examples/3.secrets.cog.toml
+./tmp_cogs gen sops               ./examples/3.secrets.cog.toml --out=k8s --namespace=default
+./tmp_cogs gen sops               ./examples/3.secrets.cog.toml --out=github
+./tmp_cogs gen sops               ./examples/3.secrets.cog.toml --out=yaml --redact
 ./tmp_cogs gen kustomize          ./examples/4.read_types.cog.toml
+./tmp_cogs gen properties         ./examples/4.read_types.cog.toml --out=properties
+./tmp_cogs gen ini                ./examples/4.read_types.cog.toml --out=ini
+./tmp_cogs gen tfvars             ./examples/4.read_types.cog.toml --out=tfvars
 ./tmp_cogs gen inheritor          ./examples/5.advanced.cog.toml
 ./tmp_cogs gen flat_json          ./examples/5.advanced.cog.toml
 ./tmp_cogs gen complex_json       ./examples/5.advanced.cog.toml
 ./tmp_cogs gen inheritor          ./examples/5.advanced.cog.toml
 ./tmp_cogs gen external_inheritor ./examples/5.advanced.cog.toml
+./tmp_cogs gen transforms         ./examples/7.transforms.cog.toml
+./tmp_cogs gen app                ./examples/8.outputs.cog.toml --check
 NEWLINE_VAR="
 This Var is on More than one line
 " NVIM=nvim ./tmp_cogs gen envsubst ./examples/6.envsubst.cog.toml -e
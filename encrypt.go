@@ -0,0 +1,76 @@
+package cogs
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/getsops/sops/v3"
+	"github.com/getsops/sops/v3/age"
+	"github.com/getsops/sops/v3/config"
+	"github.com/getsops/sops/v3/pgp"
+)
+
+// EncryptOptions configures how EncryptOutput encrypts a generated output
+type EncryptOptions struct {
+	Path string   // the path whose .sops.yaml creation rule is used when no recipients are given
+	PGP  []string // PGP fingerprints to encrypt for instead of the creation rule
+	Age  []string // age recipients to encrypt for instead of the creation rule
+	// if not nil only the values of these key names are encrypted, using an encrypted_regex,
+	// SOPS matches the regex against every key name of a nested value's path so a name encrypts each value it appears in
+	Keys []string
+}
+
+// EncryptOutput encrypts a JSON, YAML, or dotenv output as a SOPS document,
+// the master keys are taken from opts or the creation rule of the .sops.yaml file nearest to opts.Path
+func EncryptOutput(output []byte, format Format, opts EncryptOptions) ([]byte, error) {
+	switch format {
+	case JSON, YAML, Dotenv:
+	default:
+		return nil, fmt.Errorf("%s outputs can not be encrypted, expected one of: json, yaml, dotenv", format)
+	}
+	rule, err := opts.rule()
+	if err != nil {
+		return nil, err
+	}
+	if opts.Keys != nil {
+		// encrypted_regex can not be combined with any other rule deciding which keys are encrypted
+		names := make([]string, len(opts.Keys))
+		for i, k := range opts.Keys {
+			names[i] = regexp.QuoteMeta(k)
+		}
+		rule = &config.Config{
+			KeyGroups:       rule.KeyGroups,
+			ShamirThreshold: rule.ShamirThreshold,
+			EncryptedRegex:  "^(" + strings.Join(names, "|") + ")$",
+		}
+	}
+	f, err := newSOPSFile(format, output, rule, DecryptKeys)
+	if err != nil {
+		return nil, err
+	}
+	return f.emit()
+}
+
+// rule returns a creation rule holding the recipients of opts,
+// or the creation rule of the .sops.yaml file nearest to opts.Path if no recipients are given
+func (opts EncryptOptions) rule() (*config.Config, error) {
+	if len(opts.PGP) == 0 && len(opts.Age) == 0 {
+		_, rule, err := creationRule(opts.Path)
+		return rule, err
+	}
+	var group sops.KeyGroup
+	for _, fp := range opts.PGP {
+		group = append(group, pgp.NewMasterKeyFromFingerprint(strings.TrimSpace(fp)))
+	}
+	if len(opts.Age) > 0 {
+		keys, err := age.MasterKeysFromRecipients(strings.Join(opts.Age, ","))
+		if err != nil {
+			return nil, err
+		}
+		for _, k := range keys {
+			group = append(group, k)
+		}
+	}
+	return &config.Config{KeyGroups: []sops.KeyGroup{group}}, nil
+}
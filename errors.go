@@ -1,13 +1,23 @@
 package cogs
 
-// import (
-//     "fmt"
-//     "strings"
-// )
+import (
+	"fmt"
+	"strings"
+)
 
-// Errors raised by package x.
+// Errors raised by package cogs.
+// Each error type below reports true for errors.Is(err, <its ErrConst>),
+// errors.As should be used to inspect the fields of a given error type
 const (
 	ErrNoEncAndNoDecrypt = errConst("NoEnc and NoDecrypt cannot both be true")
+	ErrMissingContext    = errConst("context missing from cog file")
+	ErrMissingKeys       = errConst("unable to find keys")
+	ErrDecrypt           = errConst("unable to decrypt file")
+	ErrHTTPStatus        = errConst("HTTP request returned a non 2xx status code")
+	ErrUnsupportedType   = errConst("unsupported type")
+	ErrNotASimpleValue   = errConst("not a simple value")
+	ErrDecodeFields      = errConst("unable to decode fields")
+	ErrNestConflict      = errConst("unable to nest keys")
 )
 
 type errConst string
@@ -16,30 +26,172 @@ func (err errConst) Error() string {
 	return string(err)
 }
 
-// func (err errConst) Is(target error) bool {
-//     ts := target.Error()
-//     es := string(err)
-//     return ts == es || strings.HasPrefix(ts, es+": ")
-// }
-
-// func (err errConst) wrap(inner error) error {
-//     return errWrap{msg: string(err), err: inner}
-// }
-
-// type errWrap struct {
-//     err error
-//     msg string
-// }
-
-// func (err errWrap) Error() string {
-//     if err.err != nil {
-//         return fmt.Sprintf("%s: %v", err.msg, err.err)
-//     }
-//     return err.msg
-// }
-// func (err errWrap) Unwrap() error {
-//     return err.err
-// }
-// func (err errWrap) Is(target error) bool {
-//     return errConst(err.msg).Is(target)
-// }
+// MissingContextError is returned when a context name is not present in a cog file
+type MissingContextError struct {
+	Ctx  string // the context name that was requested
+	Path string // filepath of the cog file, empty if unknown
+}
+
+func (err *MissingContextError) Error() string {
+	msg := fmt.Sprintf("%s context missing from cog file", err.Ctx)
+	if err.Path != "" {
+		msg = err.Path + ": " + msg
+	}
+	return msg
+}
+
+// Is allows errors.Is(err, ErrMissingContext) to match a MissingContextError
+func (err *MissingContextError) Is(target error) bool {
+	return target == ErrMissingContext
+}
+
+// MissingKeysError is returned when one or more keys are unable to be found
+// for a given Link.Path and Link.SubPath
+type MissingKeysError struct {
+	Path    string
+	SubPath string
+	Keys    []string // the search names that could not be found
+}
+
+func (err *MissingKeysError) Error() string {
+	subPath := "."
+	if err.SubPath != "" {
+		subPath = err.SubPath
+	}
+	var lines []string
+	for _, k := range err.Keys {
+		lines = append(lines, fmt.Sprintf("unable to find key %q", k))
+	}
+	return fmt.Sprintf("[%q, %q]:\n      %s", err.Path, subPath, strings.Join(lines, "\n      "))
+}
+
+// Is allows errors.Is(err, ErrMissingKeys) to match a MissingKeysError
+func (err *MissingKeysError) Is(target error) bool {
+	return target == ErrMissingKeys
+}
+
+// DecryptError is returned when SOPS is unable to decrypt a file
+type DecryptError struct {
+	Path     string   // filepath or URL of the encrypted file
+	Err      error    // the underlying SOPS error
+	Attempts []string // every key that decryption was attempted with and why it failed
+}
+
+func (err *DecryptError) Error() string {
+	msg := fmt.Sprintf("%s: %s: %v", err.Path, ErrDecrypt, err.Err)
+	if len(err.Attempts) > 0 {
+		msg += "\nattempted keys:\n  " + strings.Join(err.Attempts, "\n  ")
+	}
+	return msg
+}
+
+// Unwrap returns the underlying SOPS error
+func (err *DecryptError) Unwrap() error {
+	return err.Err
+}
+
+// Is allows errors.Is(err, ErrDecrypt) to match a DecryptError
+func (err *DecryptError) Is(target error) bool {
+	return target == ErrDecrypt
+}
+
+// HTTPStatusError is returned when a remote path responds with a non 2xx status code
+type HTTPStatusError struct {
+	URL    string
+	Method string
+	Status int
+	Body   []byte // the response body, if any
+}
+
+func (err *HTTPStatusError) Error() string {
+	return fmt.Sprintf("%q: %s returned status code of %d: %s", err.URL, err.Method, err.Status, err.Body)
+}
+
+// Is allows errors.Is(err, ErrHTTPStatus) to match an HTTPStatusError
+func (err *HTTPStatusError) Is(target error) bool {
+	return target == ErrHTTPStatus
+}
+
+// UnsupportedTypeError is returned when a cog manifest value maps to a type that cogs can not handle
+type UnsupportedTypeError struct {
+	Key   string
+	Value interface{}
+}
+
+func (err *UnsupportedTypeError) Error() string {
+	return fmt.Sprintf("%s: %T is an unsupported type", err.Key, err.Value)
+}
+
+// Is allows errors.Is(err, ErrUnsupportedType) to match an UnsupportedTypeError
+func (err *UnsupportedTypeError) Is(target error) bool {
+	return target == ErrUnsupportedType
+}
+
+// NotASimpleValueError is returned when a flat value is expected but a complex value was found
+type NotASimpleValueError struct {
+	Key   string
+	Value interface{}
+}
+
+func (err *NotASimpleValueError) Error() string {
+	return fmt.Sprintf("%s of type %T is not a simple value", err.Key, err.Value)
+}
+
+// Is allows errors.Is(err, ErrNotASimpleValue) to match a NotASimpleValueError
+func (err *NotASimpleValueError) Is(target error) bool {
+	return target == ErrNotASimpleValue
+}
+
+// FieldsError is returned when resolved values are unable to be decoded into the fields of a struct
+type FieldsError struct {
+	Missing []string // required fields that have no corresponding key
+	Invalid []string // descriptions of fields that were unable to hold their corresponding value
+}
+
+func (err *FieldsError) Error() string {
+	var lines []string
+	for _, field := range err.Missing {
+		lines = append(lines, fmt.Sprintf("missing field %q", field))
+	}
+	lines = append(lines, err.Invalid...)
+	return fmt.Sprintf("%s:\n      %s", ErrDecodeFields, strings.Join(lines, "\n      "))
+}
+
+// Is allows errors.Is(err, ErrDecodeFields) to match a FieldsError
+func (err *FieldsError) Is(target error) bool {
+	return target == ErrDecodeFields
+}
+
+// NestConflictError is returned when a key is unable to be nested since it
+// holds a value while also being the parent of other keys
+type NestConflictError struct {
+	Keys []string // the keys that are both a value and a parent
+}
+
+func (err *NestConflictError) Error() string {
+	var lines []string
+	for _, k := range err.Keys {
+		lines = append(lines, fmt.Sprintf("%q is both a value and a parent of other keys", k))
+	}
+	return fmt.Sprintf("%s:\n      %s", ErrNestConflict, strings.Join(lines, "\n      "))
+}
+
+// Is allows errors.Is(err, ErrNestConflict) to match a NestConflictError
+func (err *NestConflictError) Is(target error) bool {
+	return target == ErrNestConflict
+}
+
+// resolveError combines the errors found while resolving a context,
+// formatting into a readable multi-line error message while still allowing
+// errors.Is and errors.As to inspect each underlying error
+type resolveError struct {
+	err error
+}
+
+func (err resolveError) Error() string {
+	return fmt.Sprintf("%+v", err.err)
+}
+
+func (err resolveError) Unwrap() error {
+	return err.err
+}
@@ -15,10 +15,12 @@ type ReadType string
 
 const (
 	// read format overrides
-	rDotenv ReadType = "dotenv"
-	rJSON   ReadType = "json"
-	rYAML   ReadType = "yaml"
-	rTOML   ReadType = "toml"
+	rDotenv     ReadType = "dotenv"
+	rJSON       ReadType = "json"
+	rYAML       ReadType = "yaml"
+	rTOML       ReadType = "toml"
+	rProperties ReadType = "properties"
+	rINI        ReadType = "ini"
 	// complex values of a given markup type are appended with "{}"
 	rJSONComplex ReadType = "json{}" // complex JSON key value pair: {"k":{"v1":[],"v2":[]}}
 	rYAMLComplex ReadType = "yaml{}" // complex YAML key value pair: {k: {v1: [], v2: []}}
@@ -32,7 +34,7 @@ const (
 // Validate ensures that a string is a valid readType enum
 func (t ReadType) Validate() error {
 	switch t {
-	case rDotenv, rJSON, rYAML, rTOML,
+	case rDotenv, rJSON, rYAML, rTOML, rProperties, rINI,
 		rJSONComplex, rYAMLComplex, rTOMLComplex, rWhole,
 		deferred:
 		return nil
@@ -75,6 +77,10 @@ func (t ReadType) String() string {
 		return "flat yaml"
 	case rTOML:
 		return "flat toml"
+	case rProperties:
+		return string(rProperties)
+	case rINI:
+		return string(rINI)
 	case rJSONComplex:
 		return "complex json"
 	case rYAMLComplex:
@@ -98,23 +104,40 @@ type Format string
 
 // Formats for respective object notation
 const (
-	JSON   Format = "json"
-	YAML   Format = "yaml"
-	TOML   Format = "toml"
-	Dotenv Format = "dotenv"
-	Raw    Format = "raw"
+	JSON       Format = "json"
+	YAML       Format = "yaml"
+	TOML       Format = "toml"
+	Dotenv     Format = "dotenv"
+	Raw        Format = "raw"
+	Properties Format = "properties" // Java .properties
+	INI        Format = "ini"
+	Tfvars     Format = "tfvars"  // Terraform variable definitions, read from any HCL file
+	K8s        Format = "k8s"     // Kubernetes ConfigMap and Secret manifests
+	Compose    Format = "compose" // docker-compose environment block
+	Shell      Format = "shell"   // export statements for a given ShellDialect
+	GitHub     Format = "github"  // GitHub Actions $GITHUB_ENV/$GITHUB_OUTPUT files
+	GitLab     Format = "gitlab"  // GitLab CI dotenv reports
 )
 
 // Validate ensures that a string maps to a valid Format
 func (t Format) Validate() error {
 	switch t {
-	case JSON, YAML, TOML, Dotenv, Raw:
+	case JSON, YAML, TOML, Dotenv, Raw, K8s, Compose, Properties, INI, Tfvars, Shell, GitHub, GitLab:
 		return nil
 	default: // deferred readType should not be validated
 		return fmt.Errorf("%s is an invalid Format", string(t))
 	}
 }
 
+// isFlat returns true if every value of a given Format must be output as a string
+func (t Format) isFlat() bool {
+	switch t {
+	case Dotenv, Raw, K8s, Compose, Properties, INI, Shell, GitHub, GitLab:
+		return true
+	}
+	return false
+}
+
 // FormatForPath returns the correct format given the path to a file
 func FormatForPath(path string) Format {
 	format := Raw
@@ -127,6 +150,12 @@ func FormatForPath(path string) Format {
 		format = JSON
 	case IsEnvFile(path):
 		format = Dotenv
+	case IsPropertiesFile(path):
+		format = Properties
+	case IsINIFile(path):
+		format = INI
+	case IsHCLFile(path):
+		format = Tfvars
 	}
 	return format
 }
@@ -138,6 +167,10 @@ func FormatLinkInput(link *Link) (format Format) {
 		format = JSON
 	case rDotenv:
 		format = Dotenv
+	case rProperties:
+		format = Properties
+	case rINI:
+		format = INI
 	// grab Format from filepath suffix if there are no explicit type overrides
 	default:
 		format = FormatForPath(link.Path)
@@ -165,6 +198,21 @@ func IsEnvFile(path string) bool {
 	return strings.HasSuffix(path, ".env")
 }
 
+// IsPropertiesFile returns true if a given file path corresponds to a Java .properties file
+func IsPropertiesFile(path string) bool {
+	return strings.HasSuffix(path, ".properties")
+}
+
+// IsINIFile returns true if a given file path corresponds to an INI file
+func IsINIFile(path string) bool {
+	return strings.HasSuffix(path, ".ini") || strings.HasSuffix(path, ".cfg")
+}
+
+// IsHCLFile returns true if a given file path corresponds to an HCL file
+func IsHCLFile(path string) bool {
+	return strings.HasSuffix(path, ".tfvars") || strings.HasSuffix(path, ".tf") || strings.HasSuffix(path, ".hcl")
+}
+
 // IsSimpleValue is intended to see if the underlying value allows a flat map to be retained
 func IsSimpleValue(i interface{}) bool {
 	switch i.(type) {
@@ -178,8 +226,6 @@ func IsSimpleValue(i interface{}) bool {
 	return false
 }
 
-// TODO  ErrNotASimpleValue = errorW{fmt:"%s of type %T is not a simple value"}
-
 // SimpleValueToString converts an underlying type to a string, returning an error if it is not a simple value
 func SimpleValueToString(i interface{}) (str string, err error) {
 	switch t := i.(type) {
@@ -212,7 +258,7 @@ func SimpleValueToString(i interface{}) (str string, err error) {
 	case float64:
 		str = strconv.FormatFloat(t, 'E', -1, 32)
 	default:
-		err = fmt.Errorf("%s of type %T is not a simple value", t, t)
+		err = &NotASimpleValueError{Key: fmt.Sprintf("%v", t), Value: t}
 	}
 	return str, err
 }
@@ -5,11 +5,14 @@ import (
 	"net/http"
 	"os"
 	"path"
+	"sort"
+	"strings"
 
 	"github.com/mitchellh/mapstructure"
 	"github.com/pelletier/go-toml"
 	"github.com/pkg/errors"
 	"go.uber.org/multierr"
+	"gopkg.in/yaml.v3"
 )
 
 // NoEnc decides whether to handle encrypted variables
@@ -24,13 +27,29 @@ var EnvSubst bool = false
 // RecursionLimit is the limit used to define when to abort successive traversals of gears
 var RecursionLimit int = 12
 
+// source is a loaded path along with whether it held SOPS metadata without being declared as encrypted,
+// or the tables holding SOPS metadata that were decrypted for the cog file itself
+type source struct {
+	Visitor
+	sops   bool
+	tables map[*yaml.Node]bool // the decrypted SOPS tables of the cog file, only set for the self path
+}
+
 // distinctPath is used to separate k/v pairs that share the same URL path but
-// with differing bodies/headers/methods
+// with differing bodies/headers/methods, or that differ in whether the path needs decrypting
 type distinctPath struct {
-	path   string
-	header string
-	method string
-	body   string
+	path      string
+	header    string
+	method    string
+	body      string
+	encrypted bool
+}
+
+// sourceKey identifies a loaded path shared across Gears, paths are loaded and decrypted
+// separately for contexts with a differing KeyConfig
+type sourceKey struct {
+	distinctPath
+	keys string
 }
 
 // Link holds all the data needed to resolve one string key value pair
@@ -40,12 +59,13 @@ type Link struct {
 	Value      interface{} // Holds a complex or simple value for the given Link
 	Path       string      // filepath string where Link can be resolved
 	SubPath    string      // object traversal string used to resolve Link if not at top level of document (yq syntax)
-	encrypted  bool        // indicates if decryption is needed to resolve Link.Value
+	encrypted  bool        // indicates that the Link was declared in ctx.enc.vars, set encrypted = true, or read from a SOPS file
 	remote     bool        // indicates if an HTTP request is needed to return the given document
 	header     http.Header // HTTP request headers
 	method     string      // HTTP request method
 	body       string      // HTTP request body
 	keys       []string    // key filter for Gear read types
+	transforms []string    // transforms applied to Value once it is resolved
 	readType   ReadType
 }
 
@@ -60,13 +80,19 @@ func (c Link) distinctPath() distinctPath {
 	}
 
 	return distinctPath{
-		path:   c.Path,
-		header: header,
-		method: c.method,
-		body:   c.body,
+		path:      c.Path,
+		header:    header,
+		method:    c.method,
+		body:      c.body,
+		encrypted: c.encrypted,
 	}
 }
 
+// decrypt returns true if decryption is needed to resolve Link.Value
+func (c Link) decrypt() bool {
+	return c.encrypted && !NoDecrypt
+}
+
 // String holds the string representation of a Link struct
 func (c Link) String() string {
 	return fmt.Sprintf(`Link{
@@ -85,7 +111,92 @@ type LinkMap map[string]*Link
 // CfgMap is meant to represent a map with values of one or more unknown types
 type CfgMap map[string]interface{}
 
-// LinkFilter if a function meant to filter a LinkMap
+// Config is the ordered output of a resolved context
+type Config struct {
+	Keys      []string // key order of Values, defaults to the order keys were declared in the cog file
+	Values    CfgMap
+	encrypted map[string]bool   // keys of values that were encrypted, see Config.Encrypted
+	inputs    map[string]Format // format that each value was read from, see Config.Convert
+}
+
+// newConfig returns a Config ordering the keys of cfgMap by the given order,
+// retaining which keys were resolved from encrypted Links in linkMap and the format they were read from
+func newConfig(cfgMap CfgMap, order []string, linkMap LinkMap) *Config {
+	keys := make([]string, 0, len(cfgMap))
+	encrypted := make(map[string]bool)
+	inputs := make(map[string]Format)
+	for k := range cfgMap {
+		keys = append(keys, k)
+		link, ok := linkMap[k]
+		if !ok {
+			continue
+		}
+		if link.encrypted {
+			encrypted[k] = true
+		}
+		inputs[k] = FormatLinkInput(link)
+	}
+	sortByOrder(keys, order)
+	return &Config{Keys: keys, Values: cfgMap, encrypted: encrypted, inputs: inputs}
+}
+
+// Filter returns a copy of the Config holding only the given keys, retaining the key order of the Config
+func (c *Config) Filter(keys []string) *Config {
+	cfg := &Config{Values: make(CfgMap), encrypted: make(map[string]bool), inputs: make(map[string]Format)}
+	for _, k := range c.Keys {
+		if !InList(k, keys) {
+			continue
+		}
+		cfg.Keys = append(cfg.Keys, k)
+		cfg.Values[k] = c.Values[k]
+		cfg.encrypted[k] = c.encrypted[k]
+		cfg.inputs[k] = c.inputs[k]
+	}
+	return cfg
+}
+
+// Convert returns a copy of a Config generated for a structured format such as JSON,
+// with its values converted as if the Config was generated for outputType.
+// This lets a single generated Config be marshalled to many formats
+func (c *Config) Convert(outputType Format) (*Config, error) {
+	cfg := &Config{Keys: append([]string{}, c.Keys...), Values: make(CfgMap), encrypted: c.encrypted, inputs: c.inputs}
+	for _, k := range c.Keys {
+		v, err := outputValue(c.Values[k], c.inputs[k], outputType)
+		if err != nil {
+			return nil, errors.Wrap(err, k)
+		}
+		cfg.Values[k] = v
+	}
+	return cfg, nil
+}
+
+// ModKeys returns a copy of the Config with every key name passed through modFn in order
+func (c *Config) ModKeys(modFn ...func(string) string) *Config {
+	modCfg := &Config{Values: make(CfgMap), encrypted: make(map[string]bool)}
+	for _, k := range c.Keys {
+		modKey := k
+		for _, fn := range modFn {
+			modKey = fn(modKey)
+		}
+		modCfg.Keys = append(modCfg.Keys, modKey)
+		modCfg.Values[modKey] = c.Values[k]
+		modCfg.encrypted[modKey] = c.encrypted[k]
+	}
+	return modCfg
+}
+
+// Encrypted returns true if the value for key was declared in ctx.enc.vars,
+// marked with encrypted = true, or read from a file holding SOPS metadata
+func (c *Config) Encrypted(key string) bool {
+	return c.encrypted[key]
+}
+
+// Sort orders Config.Keys lexicographically instead of by declaration order
+func (c *Config) Sort() {
+	sort.Strings(c.Keys)
+}
+
+// LinkFilter if a function meant to filter a LinkMap, a nil LinkFilter leaves the LinkMap unchanged
 type LinkFilter func(LinkMap) (LinkMap, error)
 
 // Resolver is meant to define an object that returns the final string map to be used in a configuration
@@ -102,13 +213,16 @@ type Resolver interface {
 // of how one Cog manifest file can have many contexts/environments
 type Gear struct {
 	Name       string
+	ctx        string // name of the context being resolved
 	linkMap    LinkMap
 	filePath   string     // filepath of file.cog.toml
 	fileValue  []byte     // byte representation of TOML file
 	tree       *toml.Tree // TOML object tree
 	outputType Format     // desired output type of the marshalled Gear
+	keyOrder   []string   // order that the context keys were declared in
 	recursions uint       // the amount of recursions for the current Gear
 	filter     LinkFilter
+	sources    map[sourceKey]*source // visitors for every loaded path, can be shared across Gears
 }
 
 // SetName sets the gear name to the provided string
@@ -124,7 +238,13 @@ func (g *Gear) ResolveMap(ctx baseContext) (CfgMap, error) {
 	if g.linkMap, err = parseCtx(ctx); err != nil {
 		return nil, err
 	}
-	if g.linkMap, err = g.filter(g.linkMap); err != nil {
+	if g.filter != nil {
+		if g.linkMap, err = g.filter(g.linkMap); err != nil {
+			return nil, err
+		}
+	}
+	keys, err := g.keyConfig(ctx)
+	if err != nil {
 		return nil, err
 	}
 
@@ -141,9 +261,10 @@ func (g *Gear) ResolveMap(ctx baseContext) (CfgMap, error) {
 	}
 
 	pathGroups := make(map[distinctPath]*PathGroup)
+	var pathOrder []distinctPath // retains the order Paths are first referenced in
 
 	// 1. sort Links by Path
-	for _, link := range g.linkMap {
+	for _, link := range g.orderedLinks() {
 		if link.Path == "" {
 			continue
 		}
@@ -159,80 +280,129 @@ func (g *Gear) ResolveMap(ctx baseContext) (CfgMap, error) {
 				method := link.method
 				body := link.body
 
-				if link.encrypted {
+				if link.decrypt() {
 					loadFile = func(path string) ([]byte, error) {
-						return decryptHTTPFile(path, header, method, body)
+						return decryptHTTPFile(path, header, method, body, keys)
 					}
 				} else {
 					loadFile = func(path string) ([]byte, error) {
 						return getHTTPFile(path, header, method, body)
 					}
 				}
-			case link.encrypted:
-				loadFile = decryptFile
+			case link.decrypt():
+				loadFile = func(path string) ([]byte, error) {
+					return decryptFile(path, keys)
+				}
 			}
 			pathGroups[link.distinctPath()] = &PathGroup{loadFile: loadFile, links: []*Link{}}
+			pathOrder = append(pathOrder, link.distinctPath())
 		}
 		pathGroups[link.distinctPath()].links = append(pathGroups[link.distinctPath()].links, link)
 	}
 
+	if g.sources == nil {
+		g.sources = make(map[sourceKey]*source)
+	}
+	keysID := fmt.Sprintf("%+v", keys)
+
 	var errs error
-	for p, pGroup := range pathGroups {
-		var fileBuf []byte
+	for _, p := range pathOrder {
+		pGroup := pathGroups[p]
 		// 2. for each distinct Path: generate a Reader object
-		linkFilePath := g.getLinkFilePath(p.path)
-		// if link.Path references the cog file, return the already read (and envsubst applied) value
-		if p.path == selfPath {
-			fileBuf = g.fileValue
-		} else if fileBuf, err = pGroup.loadFile(linkFilePath); err != nil {
-			if os.IsNotExist(err) {
-				errs = multierr.Append(errs, err)
-				continue
+		// unless the path was already visited by a Gear sharing the same sources
+		srcKey := sourceKey{distinctPath: p, keys: keysID}
+		src, ok := g.sources[srcKey]
+		if !ok {
+			var fileBuf []byte
+			linkFilePath := g.getLinkFilePath(p.path)
+			// if link.Path references the cog file, return the already read (and envsubst applied) value
+			if p.path == selfPath {
+				fileBuf = g.fileValue
+			} else if fileBuf, err = pGroup.loadFile(linkFilePath); err != nil {
+				if os.IsNotExist(err) {
+					errs = multierr.Append(errs, err)
+					continue
+				}
+				return nil, err
+			}
+			src = &source{}
+			if p.path == selfPath {
+				src.tables = make(map[*yaml.Node]bool)
+			}
+			// plaintext paths holding SOPS metadata are decrypted as if they were declared in ctx.enc.vars
+			if !p.encrypted && p.path != selfPath && isSOPSFile(linkFilePath, fileBuf) {
+				src.sops = true
+				if !NoDecrypt && !NoEnc {
+					if fileBuf, err = decryptData(linkFilePath, fileBuf, keys); err != nil {
+						return nil, err
+					}
+				}
 			}
-			return nil, err
-		}
 
-		newVisitor := NewYAMLVisitor
-		// 3. create visitor to handle SubPath strings
-		// all read files should resolve to a yaml.Node, this includes JSON, TOML, and dotenv
-		switch FormatForPath(linkFilePath) {
-		case JSON:
-			newVisitor = NewJSONVisitor
-		case YAML:
-			newVisitor = NewYAMLVisitor
-		case TOML:
-			newVisitor = NewTOMLVisitor
-		case Dotenv:
-			newVisitor = NewDotenvVisitor
-		}
-		visitor, err := newVisitor(fileBuf)
-		if err != nil {
-			return nil, err
+			// 3. create visitor to handle SubPath strings
+			if src.Visitor, err = visitorForPath(linkFilePath)(fileBuf); err != nil {
+				return nil, err
+			}
+			g.sources[srcKey] = src
 		}
+		visitor := src.Visitor
 
 		// 4. traverse every Path and possible SubPath retrieving the Link.Values associated with it
+		var decrypted []string
 		for _, link := range pGroup.links {
+			encrypted := src.sops
+			// the tables of the cog file that hold SOPS metadata are decrypted as they are read
+			if src.tables != nil {
+				if encrypted, err = g.decryptSelf(src, link, keys); err != nil {
+					return nil, errors.Wrap(err, link.KeyName)
+				}
+			}
+			if encrypted {
+				// skip the values of SOPS files in the same manner as ctx.enc.vars
+				if NoEnc {
+					delete(g.linkMap, link.KeyName)
+					continue
+				}
+				link.encrypted = true
+			}
 			if err := visitor.SetValue(link); err != nil {
 				return nil, errors.Wrap(err, link.KeyName)
 			}
-
+			if link.decrypt() {
+				decrypted = append(decrypted, link.KeyName)
+			}
 		}
 
-		// 5. add missing links to errs
+		// 5. record which keys were read from a decrypted path, even if other keys are missing
+		if len(decrypted) > 0 {
+			if err := audit(g.ctx, g.getLinkFilePath(p.path), decrypted); err != nil {
+				return nil, fmt.Errorf("audit: %w", err)
+			}
+		}
+		// 6. add missing links to errs
 		if viErrs := visitor.Errors(); viErrs != nil {
 			errs = multierr.Append(errs, multierr.Combine(viErrs...))
 		}
 	}
 
-	// The returned error formats into a readable multi-line error message if formatted with %+v.
+	// The returned error formats into a readable multi-line error message
+	// while allowing errors.As to retrieve each MissingKeysError
 	if errs != nil {
-		return nil, fmt.Errorf("%+v", errs)
+		return nil, resolveError{err: errs}
 	}
 
 	// final output
 	cfgOut := make(CfgMap)
-	for key, link := range g.linkMap {
-		cfgOut[key], err = OutputCfg(link, g.outputType)
+	for _, link := range g.orderedLinks() {
+		if err = applyTransforms(link); err != nil {
+			return nil, err
+		}
+		if link.encrypted && Redact != RedactNone {
+			if link.Value, err = redactValue(link.Value, Redact); err != nil {
+				return nil, errors.Wrap(err, link.KeyName)
+			}
+		}
+		cfgOut[link.KeyName], err = OutputCfg(link, g.outputType)
 		if err != nil {
 			return nil, err
 		}
@@ -242,6 +412,55 @@ func (g *Gear) ResolveMap(ctx baseContext) (CfgMap, error) {
 
 }
 
+// keyConfig returns the KeyConfig of a context: [<ctx>.decrypt] overrides [decrypt]
+// and both are overridden by DecryptKeys
+func (g *Gear) keyConfig(ctx baseContext) (KeyConfig, error) {
+	keys, err := decodeKeyConfig(g.tree.Get("decrypt"), g.filePath)
+	if err != nil {
+		return keys, err
+	}
+	ctxKeys, err := decodeKeyConfig(ctx.Decrypt, g.filePath)
+	if err != nil {
+		return keys, err
+	}
+	return keys.merge(ctxKeys).merge(DecryptKeys), nil
+}
+
+// visitorForPath returns the Visitor constructor for the format of a file path,
+// all read files should resolve to a yaml.Node, this includes JSON, TOML, dotenv, properties, INI, and HCL
+func visitorForPath(filePath string) func([]byte) (Visitor, error) {
+	switch FormatForPath(filePath) {
+	case JSON:
+		return NewJSONVisitor
+	case TOML:
+		return NewTOMLVisitor
+	case Dotenv:
+		return NewDotenvVisitor
+	case Properties:
+		return NewPropertiesVisitor
+	case INI:
+		return NewINIVisitor
+	case Tfvars:
+		return NewHCLVisitor
+	}
+	return NewYAMLVisitor
+}
+
+// orderedLinks returns the Links of a Gear in the order they were declared in the cog file
+func (g *Gear) orderedLinks() []*Link {
+	keys := make([]string, 0, len(g.linkMap))
+	for k := range g.linkMap {
+		keys = append(keys, k)
+	}
+	sortByOrder(keys, g.keyOrder)
+
+	links := make([]*Link, 0, len(keys))
+	for _, k := range keys {
+		links = append(links, g.linkMap[k])
+	}
+	return links
+}
+
 func (g *Gear) getLinkFilePath(linkPath string) string {
 	if linkPath == selfPath {
 		return g.filePath
@@ -255,36 +474,166 @@ func (g *Gear) getLinkFilePath(linkPath string) string {
 
 // Generate is a top level command that takes an context name argument and cog file path to return a string map
 func Generate(ctxName, cogPath string, outputType Format, filter LinkFilter) (CfgMap, error) {
-	var tree *toml.Tree
-	var err error
+	cfg, err := GenerateConfig(ctxName, cogPath, outputType, filter)
+	if err != nil {
+		return nil, err
+	}
+	return cfg.Values, nil
+}
 
-	if err = outputType.Validate(); err != nil {
+// GenerateConfig is a top level command that takes an context name argument and cog file path to return
+// a Config, ordered by the key declaration order of the context
+func GenerateConfig(ctxName, cogPath string, outputType Format, filter LinkFilter) (*Config, error) {
+	if err := outputType.Validate(); err != nil {
 		return nil, err
 	}
 
-	b, err := readFile(cogPath)
+	m, err := loadManifest(cogPath)
+	if err != nil {
+		return nil, err
+	}
+	gear := m.newGear(ctxName, outputType, filter)
+	cfgMap, err := generate(ctxName, m.tree, gear)
+	if err != nil {
+		return nil, err
+	}
+	return newConfig(cfgMap, m.keyOrders[ctxName], gear.linkMap), nil
+}
+
+// GenerateAll resolves many contexts of a single cog file, each context name can be
+// a path.Match pattern such as "prod-*", and every context is resolved if no names are given.
+// The cog file is parsed once and each distinct path is loaded, decrypted and visited
+// once across all contexts.
+// The Configs that were able to be resolved are returned along with an error
+// combining the errors of every context that could not be resolved
+func GenerateAll(cogPath string, outputType Format, filter LinkFilter, ctxNames ...string) (map[string]*Config, error) {
+	if err := outputType.Validate(); err != nil {
+		return nil, err
+	}
+
+	m, err := loadManifest(cogPath)
+	if err != nil {
+		return nil, err
+	}
+	names, err := m.matchContexts(ctxNames)
 	if err != nil {
 		return nil, err
 	}
 
+	sources := make(map[sourceKey]*source)
+	configs := make(map[string]*Config)
+	var errs error
+	for _, ctxName := range names {
+		gear := m.newGear(ctxName, outputType, filter)
+		gear.sources = sources
+		cfgMap, err := generate(ctxName, m.tree, gear)
+		if err != nil {
+			errs = multierr.Append(errs, err)
+			continue
+		}
+		configs[ctxName] = newConfig(cfgMap, m.keyOrders[ctxName], gear.linkMap)
+	}
+	if errs != nil {
+		return configs, resolveError{err: errs}
+	}
+	return configs, nil
+}
+
+// manifest holds a read and parsed cog file
+type manifest struct {
+	filePath  string
+	fileValue []byte              // byte representation of TOML file, envsubst applied
+	tree      *toml.Tree          // TOML object tree
+	keyOrders map[string][]string // key declaration order of every context
+}
+
+// loadManifest reads and parses the cog file found at cogPath
+func loadManifest(cogPath string) (*manifest, error) {
+	var err error
+	m := &manifest{filePath: cogPath}
+
+	if m.fileValue, err = readFile(cogPath); err != nil {
+		return nil, err
+	}
 	if EnvSubst {
-		if b, err = envSubBytes(b); err != nil {
+		if m.fileValue, err = envSubBytes(m.fileValue); err != nil {
 			return nil, err
 		}
 	}
-	if tree, err = toml.LoadBytes(b); err != nil {
+	if m.tree, err = toml.LoadBytes(m.fileValue); err != nil {
+		return nil, err
+	}
+	if m.keyOrders, err = keyOrders(m.fileValue); err != nil {
 		return nil, err
 	}
-	gear := &Gear{
-		filePath:   cogPath,
-		fileValue:  b,
-		tree:       tree,
+	return m, nil
+}
+
+// newGear returns a Gear used to resolve the given context of a manifest
+func (m *manifest) newGear(ctxName string, outputType Format, filter LinkFilter) *Gear {
+	return &Gear{
+		ctx:        ctxName,
+		filePath:   m.filePath,
+		fileValue:  m.fileValue,
+		tree:       m.tree,
 		outputType: outputType,
+		keyOrder:   m.keyOrders[ctxName],
 		recursions: 0,
 		filter:     filter,
 	}
-	return generate(ctxName, tree, gear)
+}
+
+// contexts returns the sorted names of every context in a manifest,
+// a context being a TOML table that holds a vars or enc.vars key
+func (m *manifest) contexts() []string {
+	var names []string
+	for _, k := range m.tree.Keys() {
+		if ctxTree, ok := m.tree.Get(k).(*toml.Tree); ok && (ctxTree.Has("vars") || ctxTree.Has("enc.vars")) {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// matchContexts expands any path.Match patterns in ctxNames into the matching context names
+func (m *manifest) matchContexts(ctxNames []string) ([]string, error) {
+	contexts := m.contexts()
+	if len(ctxNames) == 0 {
+		return contexts, nil
+	}
+
+	var names []string
+	for _, pattern := range ctxNames {
+		if !IsPattern(pattern) {
+			if !InList(pattern, names) {
+				names = append(names, pattern)
+			}
+			continue
+		}
+		var matched bool
+		for _, ctxName := range contexts {
+			ok, err := path.Match(pattern, ctxName)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", pattern, err)
+			}
+			if ok {
+				matched = true
+				if !InList(ctxName, names) {
+					names = append(names, ctxName)
+				}
+			}
+		}
+		if !matched {
+			return nil, &MissingContextError{Ctx: pattern, Path: m.filePath}
+		}
+	}
+	return names, nil
+}
 
+// IsPattern returns true if a context name holds any path.Match meta characters
+func IsPattern(ctxName string) bool {
+	return strings.ContainsAny(ctxName, `*?[\`)
 }
 
 func generate(ctxName string, tree *toml.Tree, gear Resolver) (CfgMap, error) {
@@ -299,23 +648,17 @@ func generate(ctxName string, tree *toml.Tree, gear Resolver) (CfgMap, error) {
 
 	ctxTree, ok := tree.Get(ctxName).(*toml.Tree)
 	if !ok {
-		// TODO  ErrMissingContext = errorW{fmt:"%s: %s context missing from cog file"}
-		errMsg := fmt.Sprintf("%s context missing from cog file", ctxName)
+		missingErr := &MissingContextError{Ctx: ctxName}
 		if g, ok := gear.(*Gear); ok {
-			errMsg = g.filePath + ": " + errMsg
+			missingErr.Path = g.filePath
 		}
-		return nil, errors.New(errMsg)
+		return nil, missingErr
 	}
 
-	var ctxMap map[string]interface{}
-	if err := ctxTree.Unmarshal(&ctxMap); err != nil {
+	if ctx, err = decodeContext(ctxTree); err != nil {
 		return nil, err
 	}
 
-	if err = mapstructure.Decode(ctxMap, &ctx); err != nil {
-		return nil, fmt.Errorf("generate context: %w", err)
-	}
-
 	genOut, err := gear.ResolveMap(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", ctxName, err)
@@ -324,6 +667,18 @@ func generate(ctxName string, tree *toml.Tree, gear Resolver) (CfgMap, error) {
 	return genOut, nil
 }
 
+// decodeContext decodes the TOML table of a context
+func decodeContext(ctxTree *toml.Tree) (ctx baseContext, err error) {
+	var ctxMap map[string]interface{}
+	if err := ctxTree.Unmarshal(&ctxMap); err != nil {
+		return ctx, err
+	}
+	if err = mapstructure.Decode(ctxMap, &ctx); err != nil {
+		return ctx, fmt.Errorf("generate context: %w", err)
+	}
+	return ctx, nil
+}
+
 // parseCtx traverses an map interface to populate a gear's configMap
 func parseCtx(ctx baseContext) (linkMap LinkMap, err error) {
 	linkMap = make(map[string]*Link)
@@ -340,6 +695,14 @@ func parseCtx(ctx baseContext) (linkMap LinkMap, err error) {
 	if err != nil {
 		return nil, err
 	}
+	// vars marked with encrypted = true are skipped along with ctx.enc.vars
+	if NoEnc {
+		for k, link := range linkMap {
+			if link.encrypted {
+				delete(linkMap, k)
+			}
+		}
+	}
 	return linkMap, nil
 }
 
@@ -353,6 +716,7 @@ type baseContext struct {
 	Header   interface{} `mapstructure:",omitempty"`
 	Method   string      `mapstructure:",omitempty"`
 	Body     string      `mapstructure:",omitempty"`
+	Decrypt  interface{} `mapstructure:",omitempty"` // decoded by decodeKeyConfig
 }
 
 // toContext returns the unencrypted context properties ignoring baseContext.Enc
@@ -425,7 +789,7 @@ func decodeVars(linkMap LinkMap, ctx context) error {
 				return fmt.Errorf("%s: %w", k, err)
 			}
 		} else {
-			return fmt.Errorf("%s: %T is an unsupported type", k, v)
+			return &UnsupportedTypeError{Key: k, Value: v}
 		}
 	}
 	return nil
@@ -438,11 +802,9 @@ func decodeEncVars(linkMap LinkMap, ctx context) error {
 		return fmt.Errorf("decodeEncVars: %w", err)
 	}
 	// since ctx.enc should always be called first, mark all output Links as encrypted
-	if !NoDecrypt {
-		for key, link := range linkMap {
-			link.encrypted = true
-			linkMap[key] = link
-		}
+	for key, link := range linkMap {
+		link.encrypted = true
+		linkMap[key] = link
 	}
 
 	return nil
@@ -505,6 +867,14 @@ func parseLinkMap(varName string, baseLink *Link, cfgMap CfgMap) (*Link, error)
 			if !ok {
 				return nil, errors.Errorf("%s.body must be a string: %T", varName, v)
 			}
+		case "encrypted":
+			if link.encrypted, ok = v.(bool); !ok {
+				return nil, fmt.Errorf("%s.encrypted must be a boolean", varName)
+			}
+		case "transform":
+			if link.transforms, err = decodeTransforms(v); err != nil {
+				return nil, fmt.Errorf("%s.transform: %w", varName, err)
+			}
 		default:
 			return nil, fmt.Errorf("%s.%s is an unsupported key name", varName, k)
 		}
@@ -0,0 +1,210 @@
+package cogs
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+	"gopkg.in/yaml.v3"
+)
+
+// NewHCLVisitor returns a visitor object that satisfies the Visitor interface
+// attempting to turn a supposed HCL byte slice (.tfvars, .tf, .hcl) into a *yaml.Node object.
+// Attributes are mapped to keys and blocks are mapped to nested mappings keyed by block type and labels:
+//
+//	locals { region = "us-east-1" }           -> .locals.region
+//	variable "port" { default = 8080 }        -> .variable.port.default
+//
+// only attributes holding literal values are retained, since expressions that reference
+// other values (var.x, local.y, function calls) can only be evaluated by Terraform itself
+func NewHCLVisitor(buf []byte) (Visitor, error) {
+	file, diags := hclsyntax.ParseConfig(buf, "", hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("NewHCLVisitor: %w", diags)
+	}
+	body, ok := file.Body.(*hclsyntax.Body)
+	if !ok {
+		return nil, fmt.Errorf("NewHCLVisitor: unexpected body type %T", file.Body)
+	}
+	rootNode := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	if err := visitHCLBody(rootNode, body); err != nil {
+		return nil, fmt.Errorf("NewHCLVisitor: %w", err)
+	}
+	return newVisitor(rootNode), nil
+}
+
+// visitHCLBody appends the attributes and blocks of an HCL body to a mapping node
+// in the order they were declared
+func visitHCLBody(node *yaml.Node, body *hclsyntax.Body) error {
+	attrs := make([]*hclsyntax.Attribute, 0, len(body.Attributes))
+	for _, attr := range body.Attributes {
+		attrs = append(attrs, attr)
+	}
+	sort.Slice(attrs, func(i, j int) bool {
+		return attrs[i].SrcRange.Start.Byte < attrs[j].SrcRange.Start.Byte
+	})
+	for _, attr := range attrs {
+		val, diags := attr.Expr.Value(nil)
+		if diags.HasErrors() || !val.IsWhollyKnown() {
+			continue
+		}
+		i, err := ctyToInterface(val)
+		if err != nil {
+			return fmt.Errorf("%s: %w", attr.Name, err)
+		}
+		valueNode := &yaml.Node{}
+		if err := valueNode.Encode(i); err != nil {
+			return fmt.Errorf("%s: %w", attr.Name, err)
+		}
+		node.Content = append(node.Content, strNode(attr.Name), valueNode)
+	}
+
+	for _, block := range body.Blocks {
+		// repeated block types and labels are merged into the same mapping
+		blockNode := node
+		for _, name := range append([]string{block.Type}, block.Labels...) {
+			next := mappingValue(blockNode, name)
+			if next == nil {
+				next = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+				blockNode.Content = append(blockNode.Content, strNode(name), next)
+			}
+			if next.Kind != yaml.MappingNode {
+				return fmt.Errorf("%s: block conflicts with an attribute of the same name", name)
+			}
+			blockNode = next
+		}
+		if err := visitHCLBody(blockNode, block.Body); err != nil {
+			return fmt.Errorf("%s: %w", block.Type, err)
+		}
+	}
+	return nil
+}
+
+// ctyToInterface converts a known cty value into the types produced by deserializing JSON or YAML
+func ctyToInterface(val cty.Value) (interface{}, error) {
+	if val.IsNull() {
+		return nil, nil
+	}
+	t := val.Type()
+	switch {
+	case t == cty.String:
+		return val.AsString(), nil
+	case t == cty.Bool:
+		return val.True(), nil
+	case t == cty.Number:
+		bf := val.AsBigFloat()
+		if i, accuracy := bf.Int64(); accuracy == 0 {
+			return int(i), nil
+		}
+		f, _ := bf.Float64()
+		return f, nil
+	case t.IsListType() || t.IsSetType() || t.IsTupleType():
+		list := []interface{}{}
+		for it := val.ElementIterator(); it.Next(); {
+			_, v := it.Element()
+			i, err := ctyToInterface(v)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, i)
+		}
+		return list, nil
+	case t.IsMapType() || t.IsObjectType():
+		m := make(map[string]interface{})
+		for it := val.ElementIterator(); it.Next(); {
+			k, v := it.Element()
+			i, err := ctyToInterface(v)
+			if err != nil {
+				return nil, err
+			}
+			m[k.AsString()] = i
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("unsupported HCL type: %s", t.FriendlyName())
+}
+
+// MarshalTfvars serializes a Config as a Terraform .tfvars document retaining the order of Config.Keys,
+// lists and maps read from whole or complex links are written as HCL tuples and objects
+func MarshalTfvars(cfg *Config) ([]byte, error) {
+	f := hclwrite.NewEmptyFile()
+	body := f.Body()
+	for _, k := range cfg.Keys {
+		if !hclsyntax.ValidIdentifier(k) {
+			return nil, fmt.Errorf("MarshalTfvars: %q is not a valid HCL identifier", k)
+		}
+		val, err := interfaceToCty(k, cfg.Values[k])
+		if err != nil {
+			return nil, fmt.Errorf("MarshalTfvars: %w", err)
+		}
+		body.SetAttributeValue(k, val)
+	}
+	return f.Bytes(), nil
+}
+
+// interfaceToCty converts a deserialized value into a cty value,
+// lists become tuples and maps become objects since their elements can be of mixed types
+func interfaceToCty(key string, i interface{}) (cty.Value, error) {
+	switch t := i.(type) {
+	case nil:
+		return cty.NullVal(cty.DynamicPseudoType), nil
+	case string:
+		return cty.StringVal(t), nil
+	case bool:
+		return cty.BoolVal(t), nil
+	case int:
+		return cty.NumberIntVal(int64(t)), nil
+	case int8:
+		return cty.NumberIntVal(int64(t)), nil
+	case int16:
+		return cty.NumberIntVal(int64(t)), nil
+	case int32:
+		return cty.NumberIntVal(int64(t)), nil
+	case int64:
+		return cty.NumberIntVal(t), nil
+	case uint:
+		return cty.NumberUIntVal(uint64(t)), nil
+	case uint8:
+		return cty.NumberUIntVal(uint64(t)), nil
+	case uint16:
+		return cty.NumberUIntVal(uint64(t)), nil
+	case uint32:
+		return cty.NumberUIntVal(uint64(t)), nil
+	case uint64:
+		return cty.NumberUIntVal(t), nil
+	case float32:
+		return cty.NumberFloatVal(float64(t)), nil
+	case float64:
+		return cty.NumberFloatVal(t), nil
+	case []interface{}:
+		if len(t) == 0 {
+			return cty.EmptyTupleVal, nil
+		}
+		vals := make([]cty.Value, len(t))
+		for x, v := range t {
+			val, err := interfaceToCty(fmt.Sprintf("%s[%d]", key, x), v)
+			if err != nil {
+				return cty.NilVal, err
+			}
+			vals[x] = val
+		}
+		return cty.TupleVal(vals), nil
+	case map[string]interface{}:
+		if len(t) == 0 {
+			return cty.EmptyObjectVal, nil
+		}
+		vals := make(map[string]cty.Value, len(t))
+		for k, v := range t {
+			val, err := interfaceToCty(key+"."+k, v)
+			if err != nil {
+				return cty.NilVal, err
+			}
+			vals[k] = val
+		}
+		return cty.ObjectVal(vals), nil
+	}
+	return cty.NilVal, &UnsupportedTypeError{Key: key, Value: i}
+}
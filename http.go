@@ -56,12 +56,18 @@ func getHTTPFile(urlPath string, header http.Header, method, body string) ([]byt
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
+	defer response.Body.Close()
 
 	// Copy data from the response to standard output
 	_, err = io.Copy(&buf, response.Body)
 
 	if response.StatusCode < 200 || response.StatusCode >= 300 {
-		return nil, errors.Errorf("%q: %s returned status code of %d: %s", urlPath, method, response.StatusCode, buf.Bytes())
+		return nil, &HTTPStatusError{
+			URL:    urlPath,
+			Method: method,
+			Status: response.StatusCode,
+			Body:   buf.Bytes(),
+		}
 	}
 
 	// handle io.Copy after status code check
@@ -69,8 +75,6 @@ func getHTTPFile(urlPath string, header http.Header, method, body string) ([]byt
 		return nil, errors.WithStack(err)
 	}
 
-	defer response.Body.Close()
-
 	return buf.Bytes(), nil
 }
 
@@ -0,0 +1,142 @@
+package cogs
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"gopkg.in/ini.v1"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultINISeparator delimits the section name from the key name when a Config is output as INI
+const DefaultINISeparator = "."
+
+// NewINIVisitor returns a visitor object that satisfies the Visitor interface
+// attempting to turn a supposed INI byte slice into a *yaml.Node object
+func NewINIVisitor(buf []byte) (Visitor, error) {
+	rootNode, err := iniNode(buf)
+	if err != nil {
+		return nil, fmt.Errorf("NewINIVisitor: %w", err)
+	}
+	return newVisitor(rootNode), nil
+}
+
+// iniNode parses an INI document into a mapping node:
+// keys declared before any section header are top level strings
+// and every [section] is a nested mapping of strings so that SubPath = ".section" is able to be used
+func iniNode(buf []byte) (*yaml.Node, error) {
+	f, err := ini.LoadSources(ini.LoadOptions{AllowBooleanKeys: true}, buf)
+	if err != nil {
+		return nil, err
+	}
+	root := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for _, section := range f.Sections() {
+		node := root
+		if section.Name() != ini.DefaultSection {
+			node = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			root.Content = append(root.Content, strNode(section.Name()), node)
+		}
+		for _, key := range section.Keys() {
+			node.Content = append(node.Content, strNode(key.Name()), strNode(key.Value()))
+		}
+	}
+	return root, nil
+}
+
+// visitINI decodes an INI string, or a list of INI lines, into the cache
+func visitINI(cache map[string]interface{}, node *yaml.Node) error {
+	var strINI string
+	if err := node.Decode(&strINI); err != nil {
+		var sliceINI []string
+		if err := node.Decode(&sliceINI); err != nil {
+			return fmt.Errorf("unable to decode node kind %s to INI format: %w", kindStr[node.Kind], err)
+		}
+		strINI = strings.Join(sliceINI, "\n")
+	}
+	iNode, err := iniNode([]byte(strINI))
+	if err != nil {
+		return err
+	}
+	return iNode.Decode(&cache)
+}
+
+// MarshalINI serializes a Config as an INI document retaining the order of Config.Keys.
+// Key names containing sep are grouped into a section named after the text preceding the first sep:
+// "db.host" is written as host under [db] when sep is ".",
+// keys without a section are written before every section.
+// The Config should be generated using the INI Format so that every value is a string
+func MarshalINI(cfg *Config, sep string) ([]byte, error) {
+	if sep == "" {
+		sep = DefaultINISeparator
+	}
+	f := ini.Empty()
+	// sections are created up front so that the default section is always written first
+	for _, k := range cfg.Keys {
+		if section, _, ok := strings.Cut(k, sep); ok && !f.HasSection(section) {
+			if _, err := f.NewSection(section); err != nil {
+				return nil, fmt.Errorf("MarshalINI: %w", err)
+			}
+		}
+	}
+	for _, k := range cfg.Keys {
+		v, err := SimpleValueToString(cfg.Values[k])
+		if err != nil {
+			return nil, fmt.Errorf("MarshalINI: %s: %w", k, err)
+		}
+		section, name, ok := strings.Cut(k, sep)
+		if !ok {
+			section, name = ini.DefaultSection, k
+		}
+		if _, err := f.Section(section).NewKey(name, v); err != nil {
+			return nil, fmt.Errorf("MarshalINI: %s: %w", k, err)
+		}
+	}
+	return writeINI(f)
+}
+
+// marshalINIMap serializes a complex value read from an INI file,
+// nested maps are written as sections after every top level key
+func marshalINIMap(m map[string]interface{}) ([]byte, error) {
+	f := ini.Empty()
+	for _, k := range sortedKeys(m) {
+		section, ok := m[k].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		s, err := f.NewSection(k)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range sortedKeys(section) {
+			v, err := SimpleValueToString(section[name])
+			if err != nil {
+				return nil, fmt.Errorf("%s.%s: %w", k, name, err)
+			}
+			if _, err := s.NewKey(name, v); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, k := range sortedKeys(m) {
+		if _, ok := m[k].(map[string]interface{}); ok {
+			continue
+		}
+		v, err := SimpleValueToString(m[k])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", k, err)
+		}
+		if _, err := f.Section(ini.DefaultSection).NewKey(k, v); err != nil {
+			return nil, err
+		}
+	}
+	return writeINI(f)
+}
+
+func writeINI(f *ini.File) ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := f.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"os"
 	"regexp"
-	"sort"
 	"strings"
 
 	"github.com/drone/envsubst"
@@ -68,7 +67,7 @@ var kindStr = map[yaml.Kind]string{
 // Visitor allows a query path to return the underlying value for a given visitor
 type Visitor interface {
 	SetValue(*Link) error
-	Errors() []error
+	Errors() []error // returns and clears the errors found since the last call
 }
 
 // NewJSONVisitor returns a visitor object that satisfies the Visitor interface
@@ -129,31 +128,37 @@ func NewDotenvVisitor(buf []byte) (Visitor, error) {
 func newVisitor(node *yaml.Node) Visitor {
 	return &visitor{
 		rootNode:       node,
-		visited:        make(map[string]map[string]interface{}),
-		visitedComplex: make(map[string]interface{}),
+		visited:        make(map[visitKey]map[string]interface{}),
+		visitedComplex: make(map[visitKey]interface{}),
 		evaluator:      yqlib.NewAllAtOnceEvaluator(),
-		missing:        make(map[string][]string), // denotes links unable to be found
+		missing:        make(map[string]*MissingKeysError), // denotes links unable to be found
 	}
 }
 
+// visitKey caches a traversed SubPath per read type,
+// since the same SubPath can be deserialized differently by each read type
+type visitKey struct {
+	subPath  string
+	readType ReadType
+}
+
 type visitor struct {
 	rootNode       *yaml.Node
-	visited        map[string]map[string]interface{}
-	visitedComplex map[string]interface{}
+	visited        map[visitKey]map[string]interface{}
+	visitedComplex map[visitKey]interface{}
 	evaluator      yqlib.Evaluator
-	missing        map[string][]string // denotes links unable to be found
+	missing        map[string]*MissingKeysError // denotes links unable to be found
+	missingOrder   []string                     // keys of missing in the order they were found
 }
 
 func (vi *visitor) Errors() []error {
 	var errs []error
-	for k, v := range vi.missing {
-		errMsg := k + ":"
-		sort.Strings(v)
-		errMsg = errMsg + "\n      " + strings.Join(v, "\n      ")
-		// do not call errors.New because we do not want a
-		// stack trace to be emitted when "%+v" is called on each error
-		errs = append(errs, errors.New(errMsg))
+	for _, errKey := range vi.missingOrder {
+		errs = append(errs, vi.missing[errKey])
 	}
+	// clear reported errors so that a visitor can be reused across contexts
+	vi.missing = make(map[string]*MissingKeysError)
+	vi.missingOrder = nil
 
 	if len(errs) > 0 {
 		return errs
@@ -166,15 +171,15 @@ func (vi *visitor) getLink(link *Link, searchMap map[string]interface{}) (interf
 		return value, ok
 	}
 	// link is unable to be found in the searchMap at this point
-	subPath := "."
-	if link.SubPath != "" {
-		subPath = link.SubPath
+	errKey := fmt.Sprintf("[%q, %q]", link.Path, link.SubPath)
+	missingErr, ok := vi.missing[errKey]
+	if !ok {
+		missingErr = &MissingKeysError{Path: link.Path, SubPath: link.SubPath}
+		vi.missing[errKey] = missingErr
+		vi.missingOrder = append(vi.missingOrder, errKey)
 	}
-
-	errKey := fmt.Sprintf("[%q, %q]", link.Path, subPath)
-	errVal := fmt.Sprintf("unable to find key %q", link.SearchName)
-	if !InList(errVal, vi.missing[errKey]) {
-		vi.missing[errKey] = append(vi.missing[errKey], errVal)
+	if !InList(link.SearchName, missingErr.Keys) {
+		missingErr.Keys = append(missingErr.Keys, link.SearchName)
 	}
 
 	return nil, false
@@ -188,13 +193,13 @@ func (vi *visitor) SetValue(link *Link) (err error) {
 	}
 
 	// 2. check if link.SubPath value has been used in a previous SetValue call
-	if flatMap, ok := vi.visited[link.SubPath]; ok {
+	if flatMap, ok := vi.visited[visitKey{link.SubPath, link.readType}]; ok {
 		if link.Value, ok = vi.getLink(link, flatMap); !ok {
 			return nil
 		}
 
 		if !IsSimpleValue(link.Value) {
-			return fmt.Errorf("%s of type %T is not a simple value", link.SearchName, link.Value)
+			return &NotASimpleValueError{Key: link.SearchName, Value: link.Value}
 		}
 
 		return nil
@@ -230,6 +235,10 @@ func (vi *visitor) SetValue(link *Link) (err error) {
 		err = visitMap(cachedMap, node, link.readType)
 	case rDotenv:
 		err = visitDotenv(cachedMap, node)
+	case rProperties:
+		err = visitProperties(cachedMap, node)
+	case rINI:
+		err = visitINI(cachedMap, node)
 	default:
 		err = fmt.Errorf("unsupported readType: %s", link.readType)
 	}
@@ -238,7 +247,7 @@ func (vi *visitor) SetValue(link *Link) (err error) {
 	}
 
 	// 5. add value to cache
-	vi.visited[link.SubPath] = cachedMap
+	vi.visited[visitKey{link.SubPath, link.readType}] = cachedMap
 
 	// 6. recurse to access cache
 	return vi.SetValue(link)
@@ -248,7 +257,7 @@ func (vi *visitor) SetValue(link *Link) (err error) {
 // visitComplex handles the rWhole and rJSONComplex read types
 func (vi *visitor) visitComplex(link *Link) (err error) {
 	// 1. check if link.SubPath and readType has been used before
-	if v, ok := vi.visitedComplex[link.SubPath]; ok {
+	if v, ok := vi.visitedComplex[visitKey{link.SubPath, link.readType}]; ok {
 		if link.readType == rWhole {
 			link.Value = v
 
@@ -289,13 +298,18 @@ func (vi *visitor) visitComplex(link *Link) (err error) {
 		return errors.Wrap(err, "visitComplex")
 	}
 	// 4. add value to cache
-	vi.visitedComplex[link.SubPath] = i
+	vi.visitedComplex[visitKey{link.SubPath, link.readType}] = i
 	// 5. recurse to access cache
 	return vi.SetValue(link)
 }
 
 func (vi *visitor) get(subPath string) (*yaml.Node, error) {
-	list, err := vi.evaluator.EvaluateNodes(subPath, vi.rootNode)
+	return evaluateNode(vi.evaluator, subPath, vi.rootNode)
+}
+
+// evaluateNode returns the single node that a yq expression resolves to
+func evaluateNode(evaluator yqlib.Evaluator, expression string, node *yaml.Node) (*yaml.Node, error) {
+	list, err := evaluator.EvaluateNodes(expression, node)
 	if err != nil {
 		return nil, err
 	}
@@ -306,7 +320,7 @@ func (vi *visitor) get(subPath string) (*yaml.Node, error) {
 	}
 	// should only match a single node
 	if len(nodes) != 1 {
-		return nil, fmt.Errorf("returned non singular result for path '%s'", subPath)
+		return nil, fmt.Errorf("returned non singular result for path '%s'", expression)
 	}
 	return nodes[0].Node, nil
 }
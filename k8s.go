@@ -0,0 +1,76 @@
+package cogs
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MarshalK8s serializes a Config as a multi-document YAML manifest holding a ConfigMap
+// for plaintext values and an Opaque Secret for values declared in ctx.enc.vars,
+// both objects share the given name and namespace.
+// The Config should be generated using the K8s Format so that every value is a string
+func MarshalK8s(cfg *Config, name, namespace string) ([]byte, error) {
+	if name == "" {
+		return nil, fmt.Errorf("MarshalK8s: a name must be provided")
+	}
+
+	configData := &yaml.Node{Kind: yaml.MappingNode}
+	secretData := &yaml.Node{Kind: yaml.MappingNode}
+	for _, k := range cfg.Keys {
+		v, err := SimpleValueToString(cfg.Values[k])
+		if err != nil {
+			return nil, fmt.Errorf("MarshalK8s: %w", err)
+		}
+		if cfg.Encrypted(k) {
+			secretData.Content = append(secretData.Content, strNode(k), strNode(base64.StdEncoding.EncodeToString([]byte(v))))
+			continue
+		}
+		configData.Content = append(configData.Content, strNode(k), strNode(v))
+	}
+
+	var docs []string
+	if len(configData.Content) > 0 {
+		configMap := k8sObject("ConfigMap", name, namespace)
+		configMap.Content = append(configMap.Content, strNode("data"), configData)
+		doc, err := yaml.Marshal(configMap)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, string(doc))
+	}
+	if len(secretData.Content) > 0 {
+		secret := k8sObject("Secret", name, namespace)
+		secret.Content = append(secret.Content,
+			strNode("type"), strNode("Opaque"),
+			strNode("data"), secretData,
+		)
+		doc, err := yaml.Marshal(secret)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, string(doc))
+	}
+	return []byte(strings.Join(docs, "---\n")), nil
+}
+
+// k8sObject returns a mapping node holding the type and object metadata of a core/v1 Kubernetes object
+func k8sObject(kind, name, namespace string) *yaml.Node {
+	metadata := &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{strNode("name"), strNode(name)}}
+	if namespace != "" {
+		metadata.Content = append(metadata.Content, strNode("namespace"), strNode(namespace))
+	}
+	return &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{
+		strNode("apiVersion"), strNode("v1"),
+		strNode("kind"), strNode(kind),
+		strNode("metadata"), metadata,
+	}}
+}
+
+// strNode returns a scalar node that always holds a string,
+// quoting values such as "true" or "5432" that would otherwise be read as another type
+func strNode(s string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: s}
+}
@@ -0,0 +1,399 @@
+package cogs
+
+import (
+	gocontext "context"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/getsops/sops/v3"
+	"github.com/getsops/sops/v3/aes"
+	"github.com/getsops/sops/v3/age"
+	"github.com/getsops/sops/v3/cmd/sops/common"
+	"github.com/getsops/sops/v3/cmd/sops/formats"
+	"github.com/getsops/sops/v3/config"
+	"github.com/getsops/sops/v3/keyservice"
+	"github.com/getsops/sops/v3/pgp"
+	"github.com/getsops/sops/v3/version"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pelletier/go-toml"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// KeyTypes that SOPS can decrypt a data key with
+var KeyTypes = []string{"pgp", "age", "kms", "gcp_kms", "azure_kv", "hc_vault"}
+
+// KeyConfig configures the key material used to decrypt SOPS files,
+// a cog file can declare it for every context under [decrypt] or for a single context under [<ctx>.decrypt]:
+//
+//	[decrypt]
+//	age_key_file = "./keys/dev.txt"
+//	gnupg_home = "/ci/gnupg"
+//	key_types = ["age", "pgp"]
+//	keyservices = ["unix:///run/sops/keyservice.sock", "tcp://keys.internal:5000"]
+//
+// Relative paths are relative to the cog file. Key types that are not configured
+// fall back to the SOPS environment variables and defaults.
+// Key services are `sops keyservice` processes that are attempted in order after the local key material
+type KeyConfig struct {
+	AgeKeyFile  string   `mapstructure:"age_key_file"` // age identities used instead of $SOPS_AGE_KEY_FILE
+	GnuPGHome   string   `mapstructure:"gnupg_home"`   // GnuPG home directory used instead of $GNUPGHOME
+	KeyTypes    []string `mapstructure:"key_types"`    // the only key types that are attempted, every type if empty
+	KeyServices []string `mapstructure:"keyservices"`  // unix:// or tcp:// URIs of remote SOPS key services
+}
+
+// DecryptKeys overrides the KeyConfig of every cog file, such as when key material is passed to the CLI
+var DecryptKeys KeyConfig
+
+// Validate ensures that every key type of a KeyConfig is a known SOPS key type
+func (k KeyConfig) Validate() error {
+	for _, keyType := range k.KeyTypes {
+		if !InList(keyType, KeyTypes) {
+			return fmt.Errorf("%s is an invalid key type, expected one of: %s", keyType, strings.Join(KeyTypes, ", "))
+		}
+	}
+	return nil
+}
+
+// merge returns a KeyConfig where every non-empty field of override replaces the field of k
+func (k KeyConfig) merge(override KeyConfig) KeyConfig {
+	if override.AgeKeyFile != "" {
+		k.AgeKeyFile = override.AgeKeyFile
+	}
+	if override.GnuPGHome != "" {
+		k.GnuPGHome = override.GnuPGHome
+	}
+	if len(override.KeyTypes) > 0 {
+		k.KeyTypes = override.KeyTypes
+	}
+	if len(override.KeyServices) > 0 {
+		k.KeyServices = override.KeyServices
+	}
+	return k
+}
+
+// ValidateKeyServices ensures that every key service of a KeyConfig is a unix:// or tcp:// URI
+func (k KeyConfig) ValidateKeyServices() error {
+	for _, uri := range k.KeyServices {
+		if _, _, err := keyServiceAddr(uri); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// keyServiceAddr returns the network and address of a unix:// or tcp:// key service URI
+func keyServiceAddr(uri string) (network, addr string, err error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", "", err
+	}
+	switch u.Scheme {
+	case "unix":
+		addr = u.Path
+	case "tcp":
+		addr = u.Host
+	default:
+		return "", "", fmt.Errorf("%s is an invalid key service, expected a unix:// or tcp:// URI", uri)
+	}
+	if addr == "" {
+		return "", "", fmt.Errorf("%s is missing an address", uri)
+	}
+	return u.Scheme, addr, nil
+}
+
+// decodeKeyConfig decodes a [decrypt] table, resolving paths relative to the cog file at cogPath
+func decodeKeyConfig(v interface{}, cogPath string) (keys KeyConfig, err error) {
+	if v == nil {
+		return keys, nil
+	}
+	if tree, ok := v.(*toml.Tree); ok {
+		v = tree.ToMap()
+	}
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{ErrorUnused: true, Result: &keys})
+	if err != nil {
+		return keys, err
+	}
+	if err := decoder.Decode(v); err != nil {
+		return keys, fmt.Errorf("decrypt: %w", err)
+	}
+	if err := keys.Validate(); err != nil {
+		return keys, fmt.Errorf("decrypt.key_types: %w", err)
+	}
+	if err := keys.ValidateKeyServices(); err != nil {
+		return keys, fmt.Errorf("decrypt.keyservices: %w", err)
+	}
+	for _, p := range []*string{&keys.AgeKeyFile, &keys.GnuPGHome} {
+		if *p != "" && !path.IsAbs(*p) {
+			*p = path.Join(path.Dir(cogPath), *p)
+		}
+	}
+	return keys, nil
+}
+
+// keyServer is a local SOPS key service that decrypts data keys using a KeyConfig,
+// recording every key that was attempted so that decryption errors can list them
+type keyServer struct {
+	keyservice.Server
+	keys     KeyConfig
+	attempts []string
+}
+
+func (ks *keyServer) Decrypt(ctx gocontext.Context, req *keyservice.DecryptRequest) (*keyservice.DecryptResponse, error) {
+	keyType, keyID := describeKey(req.Key)
+	resp, err := ks.decrypt(ctx, keyType, req)
+	if err != nil {
+		ks.attempts = append(ks.attempts, fmt.Sprintf("%s %s: %v", keyType, keyID, err))
+	}
+	return resp, err
+}
+
+func (ks *keyServer) decrypt(ctx gocontext.Context, keyType string, req *keyservice.DecryptRequest) (*keyservice.DecryptResponse, error) {
+	if len(ks.keys.KeyTypes) > 0 && !InList(keyType, ks.keys.KeyTypes) {
+		return nil, fmt.Errorf("skipped, key_types is %s", strings.Join(ks.keys.KeyTypes, ", "))
+	}
+	switch k := req.Key.KeyType.(type) {
+	case *keyservice.Key_PgpKey:
+		if ks.keys.GnuPGHome == "" {
+			break
+		}
+		key := pgp.NewMasterKeyFromFingerprint(k.PgpKey.Fingerprint)
+		key.EncryptedKey = string(req.Ciphertext)
+		pgp.GnuPGHome(ks.keys.GnuPGHome).ApplyToMasterKey(key)
+		plaintext, err := key.Decrypt()
+		if err != nil {
+			return nil, err
+		}
+		return &keyservice.DecryptResponse{Plaintext: plaintext}, nil
+	case *keyservice.Key_AgeKey:
+		if ks.keys.AgeKeyFile == "" {
+			break
+		}
+		identity, err := os.ReadFile(ks.keys.AgeKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		var identities age.ParsedIdentities
+		if err := identities.Import(string(identity)); err != nil {
+			return nil, err
+		}
+		key := &age.MasterKey{Recipient: k.AgeKey.Recipient, EncryptedKey: string(req.Ciphertext)}
+		identities.ApplyToMasterKey(key)
+		plaintext, err := key.Decrypt()
+		if err != nil {
+			return nil, err
+		}
+		return &keyservice.DecryptResponse{Plaintext: plaintext}, nil
+	}
+	return ks.Server.Decrypt(ctx, req)
+}
+
+// remoteKeyService is a SOPS key service reached over gRPC, failed attempts are recorded
+// along with those of the local keyServer
+type remoteKeyService struct {
+	keyservice.KeyServiceClient
+	uri string
+	ks  *keyServer
+}
+
+func (r *remoteKeyService) Decrypt(ctx gocontext.Context, req *keyservice.DecryptRequest, opts ...grpc.CallOption) (*keyservice.DecryptResponse, error) {
+	keyType, keyID := describeKey(req.Key)
+	// skipped key types are already recorded by the local keyServer
+	if len(r.ks.keys.KeyTypes) > 0 && !InList(keyType, r.ks.keys.KeyTypes) {
+		return nil, fmt.Errorf("skipped, key_types is %s", strings.Join(r.ks.keys.KeyTypes, ", "))
+	}
+	resp, err := r.KeyServiceClient.Decrypt(ctx, req, opts...)
+	if err != nil {
+		r.ks.attempts = append(r.ks.attempts, fmt.Sprintf("%s %s via %s: %v", keyType, keyID, r.uri, err))
+	}
+	return resp, err
+}
+
+var (
+	keyServiceMu    sync.Mutex
+	keyServiceConns = make(map[string]*grpc.ClientConn)
+)
+
+// keyServices returns the local key service of a KeyConfig followed by a client for each of its remote key services,
+// connections are shared by every SOPS file and are only established once a key is requested
+func (k KeyConfig) keyServices() (*keyServer, []keyservice.KeyServiceClient, error) {
+	ks := &keyServer{keys: k}
+	clients := []keyservice.KeyServiceClient{keyservice.NewCustomLocalClient(ks)}
+	keyServiceMu.Lock()
+	defer keyServiceMu.Unlock()
+	for _, uri := range k.KeyServices {
+		conn, ok := keyServiceConns[uri]
+		if !ok {
+			network, addr, err := keyServiceAddr(uri)
+			if err != nil {
+				return nil, nil, err
+			}
+			// passthrough hands addr to the dialer as is instead of resolving it as a DNS name
+			conn, err = grpc.NewClient("passthrough:///"+addr,
+				grpc.WithTransportCredentials(insecure.NewCredentials()),
+				grpc.WithContextDialer(func(ctx gocontext.Context, addr string) (net.Conn, error) {
+					return (&net.Dialer{}).DialContext(ctx, network, addr)
+				}),
+			)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", uri, err)
+			}
+			keyServiceConns[uri] = conn
+		}
+		clients = append(clients, &remoteKeyService{KeyServiceClient: keyservice.NewKeyServiceClient(conn), uri: uri, ks: ks})
+	}
+	return ks, clients, nil
+}
+
+// describeKey returns the SOPS key type and an identifier of a key service Key
+func describeKey(key *keyservice.Key) (keyType, keyID string) {
+	switch k := key.KeyType.(type) {
+	case *keyservice.Key_PgpKey:
+		return "pgp", k.PgpKey.Fingerprint
+	case *keyservice.Key_AgeKey:
+		return "age", k.AgeKey.Recipient
+	case *keyservice.Key_KmsKey:
+		return "kms", k.KmsKey.Arn
+	case *keyservice.Key_GcpKmsKey:
+		return "gcp_kms", k.GcpKmsKey.ResourceId
+	case *keyservice.Key_AzureKeyvaultKey:
+		return "azure_kv", k.AzureKeyvaultKey.VaultUrl + "/" + k.AzureKeyvaultKey.Name
+	case *keyservice.Key_VaultKey:
+		return "hc_vault", k.VaultKey.VaultAddress + "/" + k.VaultKey.KeyName
+	}
+	return "unknown", ""
+}
+
+// sopsFile is a decrypted SOPS document along with what is needed to encrypt it again
+type sopsFile struct {
+	store       common.Store
+	tree        sops.Tree
+	dataKey     []byte
+	cipher      sops.Cipher
+	keyServices []keyservice.KeyServiceClient
+}
+
+// decryptSOPS loads and decrypts SOPS encrypted data using the format derived from filePath
+func decryptSOPS(filePath string, encData []byte, keys KeyConfig) (*sopsFile, error) {
+	return decryptSOPSFormat(FormatForPath(filePath), filePath, encData, keys)
+}
+
+// decryptSOPSFormat loads and decrypts SOPS encrypted data of the given format,
+// filePath only identifies the data in errors
+func decryptSOPSFormat(format Format, filePath string, encData []byte, keys KeyConfig) (*sopsFile, error) {
+	store := sopsStore(format)
+	tree, err := store.LoadEncryptedFile(encData)
+	if err != nil {
+		return nil, &DecryptError{Path: filePath, Err: err}
+	}
+	// retrieve the data key first so that the error lists the attempted keys instead of the multi-line SOPS report
+	ks, keyServices, err := keys.keyServices()
+	if err != nil {
+		return nil, &DecryptError{Path: filePath, Err: err}
+	}
+	if _, err := tree.Metadata.GetDataKeyWithKeyServices(keyServices, nil); err != nil {
+		return nil, &DecryptError{Path: filePath, Err: err, Attempts: ks.attempts}
+	}
+	cipher := aes.NewCipher()
+	// the data key is cached in the tree metadata, so DecryptTree only decrypts the values and verifies the MAC
+	dataKey, err := common.DecryptTree(common.DecryptTreeOpts{Tree: &tree, Cipher: cipher})
+	if err != nil {
+		return nil, &DecryptError{Path: filePath, Err: err}
+	}
+	return &sopsFile{store: store, tree: tree, dataKey: dataKey, cipher: cipher, keyServices: keyServices}, nil
+}
+
+// newSOPSFile loads plaintext data of the given format and generates a data key
+// for the master keys of a .sops.yaml creation rule, emit encrypts the document
+func newSOPSFile(format Format, plainData []byte, rule *config.Config, keys KeyConfig) (*sopsFile, error) {
+	store := sopsStore(format)
+	branches, err := store.LoadPlainFile(plainData)
+	if err != nil {
+		return nil, err
+	}
+	metadata := sops.Metadata{
+		KeyGroups:               rule.KeyGroups,
+		ShamirThreshold:         rule.ShamirThreshold,
+		UnencryptedSuffix:       rule.UnencryptedSuffix,
+		EncryptedSuffix:         rule.EncryptedSuffix,
+		UnencryptedRegex:        rule.UnencryptedRegex,
+		EncryptedRegex:          rule.EncryptedRegex,
+		UnencryptedCommentRegex: rule.UnencryptedCommentRegex,
+		EncryptedCommentRegex:   rule.EncryptedCommentRegex,
+		MACOnlyEncrypted:        rule.MACOnlyEncrypted,
+		Version:                 version.Version,
+	}
+	// SOPS only defaults to the unencrypted suffix when no other rule is given
+	if metadata.UnencryptedSuffix == "" && metadata.EncryptedSuffix == "" && metadata.UnencryptedRegex == "" &&
+		metadata.EncryptedRegex == "" && metadata.UnencryptedCommentRegex == "" && metadata.EncryptedCommentRegex == "" {
+		metadata.UnencryptedSuffix = sops.DefaultUnencryptedSuffix
+	}
+	_, keyServices, err := keys.keyServices()
+	if err != nil {
+		return nil, err
+	}
+	f := &sopsFile{
+		store:       store,
+		tree:        sops.Tree{Branches: branches, Metadata: metadata},
+		cipher:      aes.NewCipher(),
+		keyServices: keyServices,
+	}
+	var errs []error
+	if f.dataKey, errs = f.tree.GenerateDataKeyWithKeyServices(f.keyServices); len(errs) > 0 {
+		return nil, fmt.Errorf("unable to generate a data key: %v", errs)
+	}
+	return f, nil
+}
+
+// creationRule returns the nearest .sops.yaml file to filePath along with its creation rule for filePath
+func creationRule(filePath string) (string, *config.Config, error) {
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return "", nil, err
+	}
+	configPath, err := config.FindConfigFile(absPath)
+	if err != nil {
+		return "", nil, fmt.Errorf("unable to find a .sops.yaml file: %w", err)
+	}
+	rule, err := config.LoadCreationRuleForFile(configPath, absPath, make(map[string]*string))
+	if err != nil {
+		return "", nil, err
+	}
+	if rule == nil {
+		return "", nil, fmt.Errorf("%s does not contain a creation rule for %s", configPath, filePath)
+	}
+	return configPath, rule, nil
+}
+
+// sopsStore returns the SOPS store used to load and emit documents of a format
+func sopsStore(format Format) common.Store {
+	return common.StoreForFormat(formats.FormatFromString(string(format)), config.NewStoresConfig())
+}
+
+// plaintext returns the decrypted document
+func (f *sopsFile) plaintext() ([]byte, error) {
+	return f.store.EmitPlainFile(f.tree.Branches)
+}
+
+// encrypt replaces the document with plainData and encrypts it using the original data key and metadata
+func (f *sopsFile) encrypt(plainData []byte) ([]byte, error) {
+	var err error
+	if f.tree.Branches, err = f.store.LoadPlainFile(plainData); err != nil {
+		return nil, err
+	}
+	return f.emit()
+}
+
+// emit encrypts the document using the current data key and metadata
+func (f *sopsFile) emit() ([]byte, error) {
+	if err := common.EncryptTree(common.EncryptTreeOpts{Tree: &f.tree, Cipher: f.cipher, DataKey: f.dataKey}); err != nil {
+		return nil, err
+	}
+	return f.store.EmitEncryptedFile(f.tree)
+}
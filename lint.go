@@ -0,0 +1,314 @@
+package cogs
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Lint rules reported by a Finding
+const (
+	RulePrivateKey   = "private-key"    // a PEM encoded private key
+	RuleAWSAccessKey = "aws-access-key" // an AWS access key ID
+	RuleHighEntropy  = "high-entropy"   // a long random looking string such as a token or password
+	RuleEncDuplicate = "enc-duplicate"  // a copy of an encrypted value
+)
+
+// Finding is a likely secret found in a plaintext source of a context
+type Finding struct {
+	Ctx     string `json:"ctx" yaml:"ctx"`
+	Key     string `json:"key,omitempty" yaml:"key,omitempty"` // the context key that reads the value, if any
+	File    string `json:"file" yaml:"file"`
+	SubPath string `json:"subpath" yaml:"subpath"` // yq path of the value within File
+	Rule    string `json:"rule" yaml:"rule"`
+	Detail  string `json:"detail,omitempty" yaml:"detail,omitempty"`
+}
+
+var (
+	privateKeyRegexp   = regexp.MustCompile(`-----BEGIN [A-Z0-9 ]*PRIVATE KEY( BLOCK)?-----`)
+	awsAccessKeyRegexp = regexp.MustCompile(`\b(AKIA|ASIA|AGPA|AIDA|AROA|ANPA|ANVA|AIPA)[0-9A-Z]{16}\b`)
+)
+
+// minEntropy is the Shannon entropy in bits per character above which a string is considered random
+const minEntropy = 4.0
+
+// Lint scans the plaintext sources of the given contexts for likely secrets: the context's table and self path tables
+// of the cog file, and every local file that is neither declared as encrypted nor holds SOPS metadata.
+// Each context name can be a path.Match pattern and every context is linted if no names are given.
+// Encrypted values are resolved so that plaintext copies of them can be found, NoEnc skips this rule.
+// Contexts that can not be resolved are not linted, their errors are returned along with the findings
+// of every other context
+func Lint(cogPath string, ctxNames ...string) ([]*Finding, error) {
+	m, err := loadManifest(cogPath)
+	if err != nil {
+		return nil, err
+	}
+	names, err := m.matchContexts(ctxNames)
+	if err != nil {
+		return nil, err
+	}
+	configs, resolveErr := GenerateAll(cogPath, JSON, nil, names...)
+	if configs == nil {
+		return nil, resolveErr
+	}
+	cogNode, err := NewTOMLVisitor(m.fileValue)
+	if err != nil {
+		return nil, err
+	}
+
+	var findings []*Finding
+	for _, ctxName := range names {
+		if configs[ctxName] == nil {
+			continue
+		}
+		ctxTree, ok := m.tree.Get(ctxName).(*toml.Tree)
+		if !ok {
+			return nil, &MissingContextError{Ctx: ctxName, Path: cogPath}
+		}
+		ctx, err := decodeContext(ctxTree)
+		if err != nil {
+			return nil, err
+		}
+		linkMap, err := parseCtx(ctx)
+		if err != nil {
+			return nil, err
+		}
+		l := &linter{ctx: ctxName, encValues: encryptedValues(configs[ctxName])}
+
+		// values declared in the cog file itself
+		l.file, l.links = cogPath, nil
+		for _, link := range linkMap {
+			switch {
+			case link.encrypted:
+			case link.Path == "":
+				l.links = append(l.links, lintLink{key: link.KeyName, subPath: subPathJoin("."+ctxName, "vars", link.KeyName)})
+			case link.Path == selfPath:
+				l.links = append(l.links, newLintLink(link))
+			}
+		}
+		cog := cogNode.(*visitor)
+		vars := mappingValue(mappingValue(cog.rootNode, ctxName), "vars")
+		for i := 0; vars != nil && i+1 < len(vars.Content); i += 2 {
+			// only literal values are linted, not the tables that link to other files
+			if link, ok := linkMap[vars.Content[i].Value]; ok && link.Path == "" {
+				l.walk(vars.Content[i+1], subPathJoin("."+ctxName, "vars", vars.Content[i].Value))
+			}
+		}
+		// self path links can read plaintext tables outside of the context
+		var selfPaths []string
+		for _, link := range linkMap {
+			if link.Path != selfPath || link.encrypted || InList(link.SubPath, selfPaths) {
+				continue
+			}
+			if link.SubPath == "."+ctxName || strings.HasPrefix(link.SubPath, "."+ctxName+".") {
+				continue
+			}
+			selfPaths = append(selfPaths, link.SubPath)
+		}
+		sort.Strings(selfPaths)
+		for _, subPath := range selfPaths {
+			node, err := cog.get(subPath)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", cogPath, err)
+			}
+			// SOPS tables of the cog file are encrypted
+			if table, err := cog.sopsTable(subPath, nil); err != nil || table != nil {
+				continue
+			}
+			l.walk(node, subPath)
+		}
+
+		// every plaintext local file
+		gear := m.newGear(ctxName, JSON, nil)
+		files := make(map[string][]lintLink)
+		var fileOrder []string
+		for _, link := range linkMap {
+			if link.Path == "" || link.Path == selfPath || link.encrypted || link.remote || link.readType == rGear {
+				continue
+			}
+			filePath := gear.getLinkFilePath(link.Path)
+			if _, ok := files[filePath]; !ok {
+				fileOrder = append(fileOrder, filePath)
+			}
+			files[filePath] = append(files[filePath], newLintLink(link))
+		}
+		sort.Strings(fileOrder)
+		for _, filePath := range fileOrder {
+			b, err := readFile(filePath)
+			if err != nil {
+				return nil, err
+			}
+			if isSOPSFile(filePath, b) {
+				continue
+			}
+			v, err := visitorForPath(filePath)(b)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", filePath, err)
+			}
+			l.file, l.links = filePath, files[filePath]
+			l.walk(v.(*visitor).rootNode, "")
+		}
+		findings = append(findings, l.findings...)
+	}
+	return findings, resolveErr
+}
+
+// encryptedValues maps the string form of every encrypted value of a Config to its key
+func encryptedValues(cfg *Config) map[string]string {
+	values := make(map[string]string)
+	if cfg == nil {
+		return values
+	}
+	for _, k := range cfg.Keys {
+		if !cfg.Encrypted(k) {
+			continue
+		}
+		// short values such as "true" or "8080" are too common to be reported
+		if str, err := SimpleValueToString(cfg.Values[k]); err == nil && len(str) >= 6 {
+			values[str] = k
+		}
+	}
+	return values
+}
+
+// lintLink is the location of a value that a context key reads
+type lintLink struct {
+	key     string
+	subPath string
+}
+
+func newLintLink(link *Link) lintLink {
+	subPath := link.SubPath
+	// whole files are read at SubPath, every other read type reads SearchName within SubPath
+	if link.readType != rWhole {
+		subPath = subPathJoin(subPath, link.SearchName)
+	}
+	return lintLink{key: link.KeyName, subPath: subPath}
+}
+
+type linter struct {
+	ctx       string
+	file      string
+	links     []lintLink
+	encValues map[string]string
+	findings  []*Finding
+}
+
+// walk checks every string scalar below node, subPath being the yq path of node
+func (l *linter) walk(node *yaml.Node, subPath string) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			l.walk(child, subPath)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			l.walk(node.Content[i+1], subPathJoin(subPath, node.Content[i].Value))
+		}
+	case yaml.SequenceNode:
+		for i, child := range node.Content {
+			l.walk(child, fmt.Sprintf("%s[%d]", subPath, i))
+		}
+	case yaml.ScalarNode:
+		if node.Tag != "!!str" {
+			return
+		}
+		if rule, detail := lintValue(node.Value, l.encValues); rule != "" {
+			l.findings = append(l.findings, &Finding{
+				Ctx:     l.ctx,
+				Key:     l.keyFor(subPath),
+				File:    l.file,
+				SubPath: subPath,
+				Rule:    rule,
+				Detail:  detail,
+			})
+		}
+	}
+}
+
+// keyFor returns the context key whose value is found at subPath,
+// the key reading the most specific path wins when the paths of several keys overlap
+func (l *linter) keyFor(subPath string) string {
+	var key, match string
+	found := false
+	for _, link := range l.links {
+		p := link.subPath
+		if p == "." {
+			p = ""
+		}
+		if p != "" && subPath != p &&
+			!(strings.HasPrefix(subPath, p) && (subPath[len(p)] == '.' || subPath[len(p)] == '[')) {
+			continue
+		}
+		// ties between keys reading the same path are broken by name, as l.links is unordered
+		if !found || len(p) > len(match) || (len(p) == len(match) && link.key < key) {
+			key, match, found = link.key, p, true
+		}
+	}
+	return key
+}
+
+// lintValue returns the rule that a plaintext value breaks, if any
+func lintValue(v string, encValues map[string]string) (rule, detail string) {
+	switch {
+	case encValues[v] != "":
+		return RuleEncDuplicate, "identical to the encrypted value of " + encValues[v]
+	case privateKeyRegexp.MatchString(v):
+		return RulePrivateKey, ""
+	case awsAccessKeyRegexp.MatchString(v):
+		return RuleAWSAccessKey, ""
+	case isHighEntropy(v):
+		return RuleHighEntropy, fmt.Sprintf("%.2f bits per character", entropy(v))
+	}
+	return "", ""
+}
+
+// isHighEntropy returns true for long strings without whitespace that mix letters and digits
+// and are as random as a base64 encoded token
+func isHighEntropy(v string) bool {
+	if len(v) < 20 || strings.ContainsAny(v, " \t\r\n") || strings.Contains(v, "://") {
+		return false
+	}
+	return strings.ContainsAny(v, "0123456789") && strings.IndexFunc(v, isLetter) >= 0 && entropy(v) >= minEntropy
+}
+
+func isLetter(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+}
+
+// entropy returns the Shannon entropy of a string in bits per character
+func entropy(v string) float64 {
+	counts := make(map[rune]float64)
+	var total float64
+	for _, r := range v {
+		counts[r]++
+		total++
+	}
+	var bits float64
+	for _, count := range counts {
+		p := count / total
+		bits -= p * math.Log2(p)
+	}
+	return bits
+}
+
+var subPathKeyRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// subPathJoin appends keys to a yq path, quoting keys that are not plain identifiers
+func subPathJoin(subPath string, keys ...string) string {
+	subPath = strings.TrimSuffix(subPath, ".")
+	for _, k := range keys {
+		if subPathKeyRegexp.MatchString(k) {
+			subPath += "." + k
+		} else {
+			subPath += "." + strconv.Quote(k)
+		}
+	}
+	return subPath
+}
@@ -0,0 +1,65 @@
+package cogs
+
+import (
+	"strings"
+)
+
+// Nest returns a copy of the Config where key names are split by sep into nested Configs:
+// with a sep of "." the keys "db.host" and "db.port" become the keys "host" and "port" of a Config under "db".
+// Nested Configs retain the order of Config.Keys and marshal as nested JSON, YAML, and TOML objects.
+// A NestConflictError is returned if a key holds a value while also being the parent of another key
+func (c *Config) Nest(sep string) (*Config, error) {
+	root := &Config{Values: make(CfgMap), encrypted: make(map[string]bool)}
+	conflictErr := &NestConflictError{}
+	addConflict := func(key string) {
+		if !InList(key, conflictErr.Keys) {
+			conflictErr.Keys = append(conflictErr.Keys, key)
+		}
+	}
+
+Keys:
+	for _, k := range c.Keys {
+		parts := strings.Split(k, sep)
+		node := root
+		for i, part := range parts[:len(parts)-1] {
+			v, ok := node.Values[part]
+			if !ok {
+				v = &Config{Values: make(CfgMap), encrypted: make(map[string]bool)}
+				node.Keys = append(node.Keys, part)
+				node.Values[part] = v
+			}
+			child, ok := v.(*Config)
+			if !ok {
+				addConflict(strings.Join(parts[:i+1], sep))
+				continue Keys
+			}
+			node = child
+		}
+
+		name := parts[len(parts)-1]
+		if _, ok := node.Values[name]; ok {
+			addConflict(k)
+			continue
+		}
+		node.Keys = append(node.Keys, name)
+		node.Values[name] = c.Values[k]
+		node.encrypted[name] = c.encrypted[k]
+	}
+
+	if len(conflictErr.Keys) > 0 {
+		return nil, conflictErr
+	}
+	return root, nil
+}
+
+// toMap converts a nested Config into nested maps
+func (c *Config) toMap() map[string]interface{} {
+	m := make(map[string]interface{}, len(c.Values))
+	for k, v := range c.Values {
+		if child, ok := v.(*Config); ok {
+			v = child.toMap()
+		}
+		m[k] = v
+	}
+	return m
+}
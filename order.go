@@ -0,0 +1,107 @@
+package cogs
+
+import (
+	"sort"
+
+	"github.com/pelletier/go-toml/v2/unstable"
+)
+
+// keyOrders returns the var names of every context in the order they were declared in the cog file,
+// ctx.vars and ctx.enc.vars names are interleaved based on where they appear in the file
+func keyOrders(b []byte) (map[string][]string, error) {
+	orders := make(map[string][]string)
+	seen := make(map[string]map[string]bool)
+
+	// add records the var name for a fully qualified TOML key if it is nested under
+	// <ctx>.vars or <ctx>.enc.vars
+	add := func(keyPath []string) {
+		var ctxName, name string
+		switch {
+		case len(keyPath) > 2 && keyPath[1] == "vars":
+			ctxName, name = keyPath[0], keyPath[2]
+		case len(keyPath) > 3 && keyPath[1] == "enc" && keyPath[2] == "vars":
+			ctxName, name = keyPath[0], keyPath[3]
+		default:
+			return
+		}
+		if seen[ctxName] == nil {
+			seen[ctxName] = make(map[string]bool)
+		}
+		if !seen[ctxName][name] {
+			seen[ctxName][name] = true
+			orders[ctxName] = append(orders[ctxName], name)
+		}
+	}
+
+	// walk handles inline tables which can hold nested var declarations:
+	// ctx = {vars = {var = "var_value"}}
+	var walk func(keyPath []string, value *unstable.Node)
+	walk = func(keyPath []string, value *unstable.Node) {
+		add(keyPath)
+		if value == nil || value.Kind != unstable.InlineTable {
+			return
+		}
+		children := value.Children()
+		for children.Next() {
+			kv := children.Node()
+			walk(joinKeys(keyPath, keyParts(kv)), kv.Value())
+		}
+	}
+
+	var table []string
+	p := unstable.Parser{}
+	p.Reset(b)
+	for p.NextExpression() {
+		expr := p.Expression()
+		switch expr.Kind {
+		case unstable.Table, unstable.ArrayTable:
+			table = keyParts(expr)
+			walk(table, nil)
+		case unstable.KeyValue:
+			walk(joinKeys(table, keyParts(expr)), expr.Value())
+		}
+	}
+	if err := p.Error(); err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+// keyParts returns the dotted key parts of a table or key/value expression
+func keyParts(node *unstable.Node) []string {
+	var parts []string
+	it := node.Key()
+	for it.Next() {
+		parts = append(parts, string(it.Node().Data))
+	}
+	return parts
+}
+
+// joinKeys returns a new slice so that key paths sharing a table prefix do not share a backing array
+func joinKeys(prefix, keys []string) []string {
+	keyPath := make([]string, 0, len(prefix)+len(keys))
+	keyPath = append(keyPath, prefix...)
+	return append(keyPath, keys...)
+}
+
+// sortByOrder sorts keys by their index in order,
+// keys missing from order are sorted lexicographically after the ordered keys
+func sortByOrder(keys []string, order []string) {
+	index := make(map[string]int, len(order))
+	for i, k := range order {
+		if _, ok := index[k]; !ok {
+			index[k] = i
+		}
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		iIndex, iOk := index[keys[i]]
+		jIndex, jOk := index[keys[j]]
+		switch {
+		case iOk && jOk:
+			return iIndex < jIndex
+		case iOk != jOk:
+			return iOk
+		}
+		return keys[i] < keys[j]
+	})
+}
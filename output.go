@@ -1,8 +1,10 @@
 package cogs
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/pelletier/go-toml"
 	"gopkg.in/yaml.v3"
@@ -10,14 +12,19 @@ import (
 
 // OutputCfg returns the corresponding value for a given Link struct
 func OutputCfg(link *Link, outputType Format) (interface{}, error) {
-	if outputType == Dotenv || outputType == Raw {
+	return outputValue(link.Value, FormatLinkInput(link), outputType)
+}
+
+// outputValue converts a value read from a file of inputType into a string for flat output types
+func outputValue(v interface{}, inputType, outputType Format) (interface{}, error) {
+	if outputType.isFlat() {
 		// don't try to marshal simple primitive types
-		if IsSimpleValue(link.Value) {
-			return SimpleValueToString(link.Value)
+		if IsSimpleValue(v) {
+			return SimpleValueToString(v)
 		}
-		return marshalComplexValue(link.Value, FormatLinkInput(link))
+		return marshalComplexValue(v, inputType)
 	}
-	return link.Value, nil
+	return v, nil
 }
 
 func marshalComplexValue(v interface{}, inputType Format) (output string, err error) {
@@ -32,12 +39,98 @@ func marshalComplexValue(v interface{}, inputType Format) (output string, err er
 	case TOML:
 		b, err = toml.Marshal(v)
 		output = string(b)
+	case Properties:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return "", fmt.Errorf("unable to marshal %T as properties", v)
+		}
+		b, err = marshalProperties(sortedKeys(m), m)
+		output = string(b)
+	case INI:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return "", fmt.Errorf("unable to marshal %T as INI", v)
+		}
+		b, err = marshalINIMap(m)
+		output = string(b)
+	case Tfvars:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return "", fmt.Errorf("unable to marshal %T as tfvars", v)
+		}
+		b, err = MarshalTfvars(&Config{Keys: sortedKeys(m), Values: m})
+		output = string(b)
 	case Dotenv, Raw:
 		output = fmt.Sprintf("%s", v)
 	}
 	return output, err
 }
 
+// MarshalJSON serializes a Config as a JSON object retaining the order of Config.Keys
+func (c *Config) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, k := range c.Keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(k)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(c.Values[k])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", k, err)
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// MarshalYAML serializes a Config as a YAML mapping retaining the order of Config.Keys
+func (c *Config) MarshalYAML() (interface{}, error) {
+	node := &yaml.Node{Kind: yaml.MappingNode}
+	for _, k := range c.Keys {
+		keyNode := &yaml.Node{}
+		if err := keyNode.Encode(k); err != nil {
+			return nil, err
+		}
+		valueNode := &yaml.Node{}
+		if err := valueNode.Encode(c.Values[k]); err != nil {
+			return nil, fmt.Errorf("%s: %w", k, err)
+		}
+		node.Content = append(node.Content, keyNode, valueNode)
+	}
+	return node, nil
+}
+
+// MarshalTOML serializes a Config as a TOML document retaining the order of Config.Keys
+// as far as TOML allows: key/value pairs must precede tables, so values that
+// serialize to a table are written after every other key.
+// Keys of nested Configs are written in lexicographical order
+func (c *Config) MarshalTOML() ([]byte, error) {
+	var values, tables []string
+	for _, k := range c.Keys {
+		v := c.Values[k]
+		if child, ok := v.(*Config); ok {
+			v = child.toMap()
+		}
+		b, err := toml.Marshal(map[string]interface{}{k: v})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", k, err)
+		}
+		if str := string(b); strings.HasPrefix(strings.TrimSpace(str), "[") {
+			tables = append(tables, str)
+		} else {
+			values = append(values, str)
+		}
+	}
+	return []byte(strings.Join(append(values, tables...), "")), nil
+}
+
 // Exclude produces a laundered map with exclusionList values missing
 func Exclude(exclusionList []string, linkMap LinkMap) LinkMap {
 	newLinkMap := make(LinkMap)
@@ -0,0 +1,84 @@
+package cogs
+
+import (
+	"fmt"
+	"path"
+	"sort"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/pelletier/go-toml"
+)
+
+// Output is a file that a context declares it is written to under [<ctx>.outputs]:
+//
+//	[prod.outputs]
+//	env = {file = "deploy/.env", format = "dotenv", export = true, keys = ["db_host", "db_port"]}
+//	values = {file = "values.yaml", format = "yaml", nest = "."}
+//
+// File is relative to the cog file and Format defaults to the format of the File suffix,
+// the remaining fields mirror the options of the cogs CLI
+type Output struct {
+	Name      string   `mapstructure:"-"` // the key of the output under <ctx>.outputs
+	File      string   `mapstructure:"file"`
+	Format    Format   `mapstructure:"format"`
+	Keys      []string `mapstructure:"keys"`
+	Not       []string `mapstructure:"not"`
+	Sort      bool     `mapstructure:"sort"`
+	Nest      string   `mapstructure:"nest"`
+	Export    bool     `mapstructure:"export"`
+	Preserve  bool     `mapstructure:"preserve"`
+	Sep       string   `mapstructure:"sep"`
+	K8sName   string   `mapstructure:"name"` // --name of a k8s output
+	Namespace string   `mapstructure:"namespace"`
+	Shell     string   `mapstructure:"shell"`
+}
+
+// Outputs returns the Outputs declared by a context sorted by name
+func Outputs(ctxName, cogPath string) ([]*Output, error) {
+	m, err := loadManifest(cogPath)
+	if err != nil {
+		return nil, err
+	}
+	ctxTree, ok := m.tree.Get(ctxName).(*toml.Tree)
+	if !ok {
+		return nil, &MissingContextError{Ctx: ctxName, Path: cogPath}
+	}
+	outputsTree, ok := ctxTree.Get("outputs").(*toml.Tree)
+	if !ok {
+		if ctxTree.Has("outputs") {
+			return nil, fmt.Errorf("%s.outputs must be a table", ctxName)
+		}
+		return nil, nil
+	}
+
+	var outputs []*Output
+	for _, name := range outputsTree.Keys() {
+		outputTree, ok := outputsTree.Get(name).(*toml.Tree)
+		if !ok {
+			return nil, fmt.Errorf("%s.outputs.%s must be a table", ctxName, name)
+		}
+		output := &Output{Name: name}
+		decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{ErrorUnused: true, Result: output})
+		if err != nil {
+			return nil, err
+		}
+		if err := decoder.Decode(outputTree.ToMap()); err != nil {
+			return nil, fmt.Errorf("%s.outputs.%s: %w", ctxName, name, err)
+		}
+		if output.File == "" {
+			return nil, fmt.Errorf("%s.outputs.%s: file must be a non-empty string", ctxName, name)
+		}
+		if output.Format == "" {
+			output.Format = FormatForPath(output.File)
+		}
+		if err := output.Format.Validate(); err != nil {
+			return nil, fmt.Errorf("%s.outputs.%s: %w", ctxName, name, err)
+		}
+		if !path.IsAbs(output.File) {
+			output.File = path.Join(path.Dir(cogPath), output.File)
+		}
+		outputs = append(outputs, output)
+	}
+	sort.Slice(outputs, func(i, j int) bool { return outputs[i].Name < outputs[j].Name })
+	return outputs, nil
+}
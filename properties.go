@@ -0,0 +1,156 @@
+package cogs
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/magiconair/properties"
+	"gopkg.in/yaml.v3"
+)
+
+// NewPropertiesVisitor returns a visitor object that satisfies the Visitor interface
+// attempting to turn a supposed Java .properties byte slice into a *yaml.Node object
+func NewPropertiesVisitor(buf []byte) (Visitor, error) {
+	rootNode, err := propertiesNode(string(buf))
+	if err != nil {
+		return nil, fmt.Errorf("NewPropertiesVisitor: %w", err)
+	}
+	return newVisitor(rootNode), nil
+}
+
+// propertiesNode parses a .properties document into a flat mapping node of strings,
+// retaining the order in which the keys were declared
+func propertiesNode(s string) (*yaml.Node, error) {
+	// ${key} references are left as is, envsubst is handled by the cog file
+	loader := &properties.Loader{Encoding: properties.UTF8, DisableExpansion: true}
+	p, err := loader.LoadBytes([]byte(joinSurrogates(s)))
+	if err != nil {
+		return nil, err
+	}
+	node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for _, k := range p.Keys() {
+		v, _ := p.Get(k)
+		node.Content = append(node.Content, strNode(k), strNode(v))
+	}
+	return node, nil
+}
+
+// surrogateRegexp matches a \uXXXX escaped UTF-16 surrogate pair preceded by an even number of backslashes
+var surrogateRegexp = regexp.MustCompile(`(^|[^\\])((?:\\\\)*)\\u(D[89ABab][0-9A-Fa-f]{2})\\u(D[C-Fc-f][0-9A-Fa-f]{2})`)
+
+// joinSurrogates replaces the escaped surrogate pairs that Java writes for characters outside of
+// the Basic Multilingual Plane with the character itself, as they are not decoded when a .properties file is loaded
+func joinSurrogates(s string) string {
+	// matches consume the preceding character, so adjacent pairs are joined over several passes
+	for {
+		joined := surrogateRegexp.ReplaceAllStringFunc(s, func(match string) string {
+			m := surrogateRegexp.FindStringSubmatch(match)
+			r1, _ := strconv.ParseUint(m[3], 16, 16)
+			r2, _ := strconv.ParseUint(m[4], 16, 16)
+			return m[1] + m[2] + string(utf16.DecodeRune(rune(r1), rune(r2)))
+		})
+		if joined == s {
+			return s
+		}
+		s = joined
+	}
+}
+
+// visitProperties decodes a .properties string, or a list of .properties lines, into the cache
+func visitProperties(cache map[string]interface{}, node *yaml.Node) error {
+	var strProps string
+	if err := node.Decode(&strProps); err != nil {
+		var sliceProps []string
+		if err := node.Decode(&sliceProps); err != nil {
+			return fmt.Errorf("unable to decode node kind %s to properties format: %w", kindStr[node.Kind], err)
+		}
+		strProps = strings.Join(sliceProps, "\n")
+	}
+	propsNode, err := propertiesNode(strProps)
+	if err != nil {
+		return err
+	}
+	return propsNode.Decode(&cache)
+}
+
+// MarshalProperties serializes a Config as a Java .properties document retaining the order of Config.Keys.
+// The Config should be generated using the Properties Format so that every value is a string
+func MarshalProperties(cfg *Config) ([]byte, error) {
+	return marshalProperties(cfg.Keys, cfg.Values)
+}
+
+func marshalProperties(keys []string, values map[string]interface{}) ([]byte, error) {
+	var sb strings.Builder
+	for _, k := range keys {
+		v, err := SimpleValueToString(values[k])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", k, err)
+		}
+		sb.WriteString(escapeProperty(k, true))
+		sb.WriteByte('=')
+		sb.WriteString(escapeProperty(v, false))
+		sb.WriteByte('\n')
+	}
+	return []byte(sb.String()), nil
+}
+
+// escapeProperty escapes a .properties key or value so that it reads back in unchanged
+func escapeProperty(s string, isKey bool) string {
+	var sb strings.Builder
+	for i, r := range s {
+		switch r {
+		case '\\':
+			sb.WriteString(`\\`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\t':
+			sb.WriteString(`\t`)
+		case '\f':
+			sb.WriteString(`\f`)
+		case '=', ':':
+			if isKey {
+				sb.WriteByte('\\')
+			}
+			sb.WriteRune(r)
+		case '#', '!':
+			// a leading comment character would comment out the entire line
+			if isKey && i == 0 {
+				sb.WriteByte('\\')
+			}
+			sb.WriteRune(r)
+		case ' ':
+			// spaces separate keys from values and leading value whitespace is trimmed
+			if isKey || i == 0 {
+				sb.WriteByte('\\')
+			}
+			sb.WriteRune(r)
+		default:
+			// java.util.Properties.load(InputStream) reads ISO-8859-1, so every other character is escaped
+			if r < 0x20 || r > 0x7e {
+				// characters outside of the Basic Multilingual Plane are written as a surrogate pair
+				for _, u := range utf16.Encode([]rune{r}) {
+					fmt.Fprintf(&sb, `\u%04X`, u)
+				}
+				continue
+			}
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// sortedKeys returns the keys of a map in lexicographical order
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
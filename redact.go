@@ -0,0 +1,89 @@
+package cogs
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// RedactMode decides how the values of Links declared in ctx.enc.vars are redacted
+type RedactMode string
+
+// RedactModes supported by Redact
+const (
+	RedactNone RedactMode = ""     // values are output as is
+	RedactMask RedactMode = "mask" // values are replaced by RedactedValue
+	RedactHash RedactMode = "hash" // values are replaced by a short HMAC-SHA256 so that differing values can be told apart
+)
+
+// RedactedValue replaces every encrypted value when Redact is set to RedactMask
+const RedactedValue = "***"
+
+// Redact decides whether encrypted values are replaced before they are output,
+// plaintext values are never redacted
+var Redact RedactMode = RedactNone
+
+// RedactKey is the HMAC key used by RedactHash. A random key is generated once per process if RedactKey is empty,
+// so hashes can only be compared across runs that share a RedactKey. Anyone holding the key can test guesses
+// of a value against its hash, so a shared key should be kept as secret as the values themselves
+var RedactKey []byte
+
+var (
+	redactKeyOnce sync.Once
+	redactKey     []byte
+)
+
+// hashKey returns RedactKey, or a random key that is generated once per process
+func hashKey() ([]byte, error) {
+	if len(RedactKey) > 0 {
+		return RedactKey, nil
+	}
+	var err error
+	redactKeyOnce.Do(func() {
+		redactKey = make([]byte, 32)
+		_, err = rand.Read(redactKey)
+	})
+	return redactKey, err
+}
+
+// Validate ensures that a string maps to a valid RedactMode
+func (r RedactMode) Validate() error {
+	switch r {
+	case RedactNone, RedactMask, RedactHash:
+		return nil
+	}
+	return fmt.Errorf("%s is an invalid RedactMode", string(r))
+}
+
+// redactValue returns the value that replaces v for the given RedactMode
+func redactValue(v interface{}, mode RedactMode) (interface{}, error) {
+	switch mode {
+	case RedactNone:
+		return v, nil
+	case RedactMask:
+		return RedactedValue, nil
+	case RedactHash:
+		str, err := SimpleValueToString(v)
+		if err != nil {
+			// complex values are hashed using their JSON encoding
+			b, err := json.Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+			str = string(b)
+		}
+		// a keyed hash keeps short or guessable values from being brute forced offline
+		key, err := hashKey()
+		if err != nil {
+			return nil, err
+		}
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(str))
+		return "hmac:" + hex.EncodeToString(mac.Sum(nil))[:12], nil
+	}
+	return nil, mode.Validate()
+}
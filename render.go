@@ -0,0 +1,116 @@
+package cogs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TemplateFuncs returns the helper functions available to templates executed by Render:
+//
+//	{{ .host | quote }}                  "localhost"
+//	{{ .password | squote }}             'pass'\''word', safe for sh
+//	{{ .db | json }}                     {"host":"localhost","port":5432}
+//	{{ .db | yaml | indent 2 }}          YAML that is indented by two spaces
+//	{{ .port | default 8080 }}           8080 if port is missing or empty
+//	{{ required "port is required" .port }} fails rendering if port is missing or empty
+func TemplateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"quote":    func(v interface{}) string { return strconv.Quote(toString(v)) },
+		"squote":   func(v interface{}) string { return "'" + strings.ReplaceAll(toString(v), "'", `'\''`) + "'" },
+		"json":     toJSON,
+		"yaml":     toYAML,
+		"indent":   indent,
+		"default":  defaultValue,
+		"required": required,
+	}
+}
+
+// Render resolves the given context and executes the template file at templatePath
+// using the resolved values as the template data
+func Render(ctxName, cogPath, templatePath string, filter LinkFilter, w io.Writer) error {
+	text, err := readFile(templatePath)
+	if err != nil {
+		return err
+	}
+	cfg, err := GenerateConfig(ctxName, cogPath, JSON, filter)
+	if err != nil {
+		return err
+	}
+	return RenderTemplate(cfg, filepath.Base(templatePath), string(text), w)
+}
+
+// RenderTemplate executes a text/template using the values of a Config as the template data,
+// the functions returned by TemplateFuncs are available to the template
+func RenderTemplate(cfg *Config, name, text string, w io.Writer) error {
+	tmpl, err := template.New(name).Funcs(TemplateFuncs()).Parse(text)
+	if err != nil {
+		return err
+	}
+	// buffer the output so that nothing is written if execution fails part way through
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, map[string]interface{}(cfg.Values)); err != nil {
+		return err
+	}
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// toString formats simple values the same way as every flat output Format
+func toString(v interface{}) string {
+	if str, err := SimpleValueToString(v); err == nil {
+		return str
+	}
+	return fmt.Sprint(v)
+}
+
+func toJSON(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+func toYAML(v interface{}) (string, error) {
+	b, err := yaml.Marshal(v)
+	return strings.TrimSuffix(string(b), "\n"), err
+}
+
+// indent prefixes every line of a string with n spaces
+func indent(n int, s string) string {
+	pad := strings.Repeat(" ", n)
+	return pad + strings.ReplaceAll(s, "\n", "\n"+pad)
+}
+
+// isEmpty returns true for missing values and zero values
+func isEmpty(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return rv.Len() == 0
+	}
+	return rv.IsZero()
+}
+
+func defaultValue(d interface{}, v ...interface{}) interface{} {
+	if len(v) == 0 || isEmpty(v[0]) {
+		return d
+	}
+	return v[0]
+}
+
+func required(msg string, v interface{}) (interface{}, error) {
+	if isEmpty(v) {
+		return nil, fmt.Errorf("%s", msg)
+	}
+	return v, nil
+}
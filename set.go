@@ -0,0 +1,569 @@
+package cogs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mikefarah/yq/v4/pkg/yqlib"
+	"github.com/pelletier/go-toml"
+	tomlv2 "github.com/pelletier/go-toml/v2"
+	"github.com/pelletier/go-toml/v2/unstable"
+	"gopkg.in/yaml.v3"
+)
+
+// Set writes value to the file that a key of the given context resolves from,
+// using the Path, SubPath, and name of the key's Link to find the value to replace.
+// YAML, JSON, TOML, and dotenv files are updated in place while keeping the rest of the file intact,
+// and SOPS encrypted files are decrypted, updated, and re-encrypted using their existing SOPS metadata.
+// Keys without a path are updated in the cog file itself, as are self path keys which may read from a SOPS table,
+// remote paths can not be set
+func Set(ctxName, cogPath, key, value string) error {
+	m, err := loadManifest(cogPath)
+	if err != nil {
+		return err
+	}
+	ctxTree, ok := m.tree.Get(ctxName).(*toml.Tree)
+	if !ok {
+		return &MissingContextError{Ctx: ctxName, Path: cogPath}
+	}
+	ctx, err := decodeContext(ctxTree)
+	if err != nil {
+		return err
+	}
+	linkMap, err := parseCtx(ctx)
+	if err != nil {
+		return err
+	}
+	link, ok := linkMap[key]
+	if !ok {
+		return fmt.Errorf("%s is not a key of the %s context", key, ctxName)
+	}
+
+	gear := m.newGear(ctxName, JSON, nil)
+	keys, err := gear.keyConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	var filePath string
+	var edit func([]byte) ([]byte, error)
+	var decrypted bool // whether the file was decrypted to be edited
+	switch {
+	case link.Path == "":
+		// the value is declared in the cog file itself: [ctx.vars] or [ctx.enc.vars]
+		keyPath := []interface{}{ctxName, "vars"}
+		if link.encrypted {
+			keyPath = []interface{}{ctxName, "enc", "vars"}
+		}
+		filePath = cogPath
+		edit = func(b []byte) ([]byte, error) {
+			return setTOML(b, append(keyPath, key), value)
+		}
+		link.encrypted = false
+	case link.remote:
+		return fmt.Errorf("%s: %q is a remote path and can not be set", key, link.Path)
+	case link.readType.isComplex() || link.readType == rGear:
+		return fmt.Errorf("%s: %s values can not be set", key, link.readType)
+	case link.Path == selfPath:
+		// the value is read from a table of the cog file, which may be SOPS encrypted
+		filePath = cogPath
+		self := *link
+		edit = func(b []byte) (out []byte, err error) {
+			out, decrypted, err = setSelf(b, cogPath, &self, value, keys)
+			return out, err
+		}
+		link.encrypted = false
+	default:
+		filePath = gear.getLinkFilePath(link.Path)
+		format := FormatForPath(filePath)
+		// a read type that differs from the file's format would edit the file as the wrong format
+		if link.readType != deferred && Format(link.readType) != format {
+			return fmt.Errorf("%s: %s values embedded in a %s file can not be set", key, link.readType, format)
+		}
+		edit = func(b []byte) ([]byte, error) {
+			return setValue(format, b, link.SubPath, link.SearchName, value)
+		}
+	}
+
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return err
+	}
+	b, err := readFile(filePath)
+	if err != nil {
+		return err
+	}
+	if link.encrypted || isSOPSFile(filePath, b) {
+		b, err = editEncrypted(filePath, b, keys, func(plainData []byte) ([]byte, error) {
+			decrypted = true
+			return edit(plainData)
+		})
+	} else {
+		b, err = edit(b)
+	}
+	if decrypted {
+		if err := audit(ctxName, filePath, []string{key}); err != nil {
+			return fmt.Errorf("audit: %w", err)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %s: %w", key, filePath, err)
+	}
+	return os.WriteFile(filePath, b, info.Mode())
+}
+
+// editEncrypted decrypts a SOPS file, applies edit to the plaintext,
+// and encrypts the result with the data key and metadata of the original file
+func editEncrypted(filePath string, encData []byte, keys KeyConfig, edit func([]byte) ([]byte, error)) ([]byte, error) {
+	if FormatForPath(filePath) == TOML {
+		return nil, fmt.Errorf("SOPS does not support encrypting TOML files")
+	}
+	f, err := decryptSOPS(filePath, encData, keys)
+	if err != nil {
+		return nil, err
+	}
+	plainData, err := f.plaintext()
+	if err != nil {
+		return nil, err
+	}
+	if plainData, err = edit(plainData); err != nil {
+		return nil, err
+	}
+	return f.encrypt(plainData)
+}
+
+// setValue replaces the value of name in the mapping found at subPath of a file's data
+func setValue(format Format, b []byte, subPath, name, value string) ([]byte, error) {
+	switch format {
+	case YAML:
+		return setYAML(b, subPath, name, value)
+	case JSON, TOML:
+		var i interface{}
+		unmarshal := json.Unmarshal
+		if format == TOML {
+			unmarshal = toml.Unmarshal
+		}
+		if err := unmarshal(b, &i); err != nil {
+			return nil, err
+		}
+		rootNode := &yaml.Node{}
+		if err := rootNode.Encode(i); err != nil {
+			return nil, err
+		}
+		target, err := evaluateNode(yqlib.NewAllAtOnceEvaluator(), subPath, rootNode)
+		if err != nil {
+			return nil, err
+		}
+		keyPath, ok := nodePath(rootNode, target)
+		if !ok {
+			return nil, fmt.Errorf("unable to locate %q", subPath)
+		}
+		keyPath = append(keyPath, name)
+		if format == JSON {
+			return setJSON(b, keyPath, value)
+		}
+		return setTOML(b, keyPath, value)
+	case Dotenv:
+		if subPath != "" {
+			return nil, fmt.Errorf("dotenv files do not support a SubPath")
+		}
+		return setDotenv(b, name, value)
+	}
+	return nil, fmt.Errorf("%s files are not supported", format)
+}
+
+// nodePath returns the mapping keys and sequence indexes leading from root to target
+func nodePath(root, target *yaml.Node) ([]interface{}, bool) {
+	if root == target {
+		return []interface{}{}, true
+	}
+	switch root.Kind {
+	case yaml.DocumentNode:
+		for _, child := range root.Content {
+			if p, ok := nodePath(child, target); ok {
+				return p, true
+			}
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(root.Content); i += 2 {
+			if p, ok := nodePath(root.Content[i+1], target); ok {
+				return append([]interface{}{root.Content[i].Value}, p...), true
+			}
+		}
+	case yaml.SequenceNode:
+		for i, child := range root.Content {
+			if p, ok := nodePath(child, target); ok {
+				return append([]interface{}{i}, p...), true
+			}
+		}
+	}
+	return nil, false
+}
+
+// setYAML replaces the raw bytes of a scalar value, retaining its quoting style and the formatting
+// and comments of the rest of the document
+func setYAML(b []byte, subPath, name, value string) ([]byte, error) {
+	doc := &yaml.Node{}
+	if err := yaml.Unmarshal(b, doc); err != nil {
+		return nil, err
+	}
+	target, err := evaluateNode(yqlib.NewAllAtOnceEvaluator(), subPath, doc)
+	if err != nil {
+		return nil, err
+	}
+	if target.Kind == yaml.DocumentNode && len(target.Content) > 0 {
+		target = target.Content[0]
+	}
+	node := mappingValue(target, name)
+	if node == nil {
+		return nil, fmt.Errorf("unable to find key %q", name)
+	}
+	if node.Kind != yaml.ScalarNode {
+		return nil, &NotASimpleValueError{Key: name, Value: kindStr[node.Kind]}
+	}
+	if node.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0 {
+		return nil, fmt.Errorf("multi-line YAML values can not be set")
+	}
+	flow := target.Style&yaml.FlowStyle != 0
+	start, end, err := yamlScalarRange(b, node, flow)
+	if err != nil {
+		return nil, err
+	}
+
+	newValue, err := yamlScalar(node, value, flow)
+	if err != nil {
+		return nil, err
+	}
+	return append(append(append([]byte{}, b[:start]...), newValue...), b[end:]...), nil
+}
+
+// yamlScalar returns value as a single line YAML scalar in the quoting style of node
+func yamlScalar(node *yaml.Node, value string, flow bool) ([]byte, error) {
+	newNode := &yaml.Node{Kind: yaml.ScalarNode, Value: value, Style: node.Style &^ yaml.TaggedStyle}
+	// non-string values are re-resolved so that setting 8080 to 8081 retains an int
+	if node.Tag == "!!str" {
+		newNode.Tag = "!!str"
+	}
+	// plain values can not hold line breaks or, within flow collections, flow indicators
+	if newNode.Style == 0 && (strings.Contains(value, "\n") || (flow && strings.ContainsAny(value, ",[]{}"))) {
+		newNode.Style = yaml.DoubleQuotedStyle
+	}
+	newValue, err := yaml.Marshal(newNode)
+	if err != nil {
+		return nil, err
+	}
+	newValue = bytes.TrimSuffix(newValue, []byte("\n"))
+	if bytes.Contains(newValue, []byte("\n")) {
+		return nil, fmt.Errorf("%q can not be written as a single line YAML value", value)
+	}
+	return newValue, nil
+}
+
+// yamlOffset returns the byte offset of a node's 1-indexed line and column within b,
+// the column of a node counts characters rather than bytes
+func yamlOffset(b []byte, line, column int) int {
+	offset := 0
+	for l := 1; offset < len(b) && l < line; offset++ {
+		if b[offset] == '\n' {
+			l++
+		}
+	}
+	for c := 1; offset < len(b) && c < column; c++ {
+		_, size := utf8.DecodeRune(b[offset:])
+		offset += size
+	}
+	return offset
+}
+
+// yamlScalarRange returns the byte range of a scalar node's value within b, excluding any tag or anchor
+func yamlScalarRange(b []byte, node *yaml.Node, flow bool) (start, end int, err error) {
+	start = yamlOffset(b, node.Line, node.Column)
+	// skip past the tag and anchor properties of the node
+	for start < len(b) && (b[start] == '!' || b[start] == '&') {
+		for start < len(b) && b[start] != ' ' && b[start] != '\t' && b[start] != '\n' {
+			start++
+		}
+		for start < len(b) && (b[start] == ' ' || b[start] == '\t') {
+			start++
+		}
+	}
+
+	end = start
+	switch node.Style &^ (yaml.TaggedStyle | yaml.FlowStyle) {
+	case yaml.DoubleQuotedStyle:
+		for end++; end < len(b) && b[end] != '"'; end++ {
+			if b[end] == '\\' {
+				end++
+			}
+		}
+		end++
+	case yaml.SingleQuotedStyle:
+		for end++; end < len(b); end++ {
+			if b[end] == '\'' {
+				if end+1 < len(b) && b[end+1] == '\'' {
+					end++
+					continue
+				}
+				break
+			}
+		}
+		end++
+	default:
+		for ; end < len(b) && b[end] != '\n' && b[end] != '\r'; end++ {
+			if b[end] == '#' && end > start && (b[end-1] == ' ' || b[end-1] == '\t') {
+				break
+			}
+			if flow && strings.IndexByte(",]}", b[end]) >= 0 {
+				break
+			}
+		}
+		for end > start && (b[end-1] == ' ' || b[end-1] == '\t') {
+			end--
+		}
+	}
+	if end > len(b) {
+		return 0, 0, fmt.Errorf("unable to locate the value of line %d", node.Line)
+	}
+	// plain values may continue on the following lines
+	current := &yaml.Node{}
+	if err := yaml.Unmarshal(b[start:end], current); err != nil || len(current.Content) == 0 || current.Content[0].Value != node.Value {
+		return 0, 0, fmt.Errorf("multi-line YAML values can not be set")
+	}
+	return start, end, nil
+}
+
+// setJSON replaces the raw bytes of the value at keyPath, retaining the formatting of the rest of the document
+func setJSON(b []byte, keyPath []interface{}, value string) ([]byte, error) {
+	start, end, err := jsonValueRange(b, 0, keyPath)
+	if err != nil {
+		return nil, err
+	}
+	raw := bytes.TrimSpace(b[start:end])
+	if len(raw) > 0 && (raw[0] == '{' || raw[0] == '[') {
+		return nil, &NotASimpleValueError{Key: fmt.Sprint(keyPath[len(keyPath)-1]), Value: string(raw)}
+	}
+	newValue := []byte(value)
+	// retain non-string types if the new value is of a JSON scalar type
+	if raw[0] == '"' || !json.Valid(newValue) || strings.ContainsAny(value[:1], `"{[`) {
+		if newValue, err = json.Marshal(value); err != nil {
+			return nil, err
+		}
+	}
+	return append(append(append([]byte{}, b[:start]...), newValue...), b[end:]...), nil
+}
+
+// jsonValueRange returns the byte range of the value found at keyPath starting at offset i
+func jsonValueRange(b []byte, i int, keyPath []interface{}) (start, end int, err error) {
+	i = skipSpace(b, i)
+	if len(keyPath) == 0 {
+		end, err = jsonSkip(b, i)
+		return i, end, err
+	}
+	switch k := keyPath[0].(type) {
+	case string:
+		if i >= len(b) || b[i] != '{' {
+			return 0, 0, fmt.Errorf("expected an object for %q", k)
+		}
+		for i = skipSpace(b, i+1); i < len(b) && b[i] != '}'; {
+			var name string
+			dec := json.NewDecoder(bytes.NewReader(b[i:]))
+			if err := dec.Decode(&name); err != nil {
+				return 0, 0, err
+			}
+			i = skipSpace(b, i+int(dec.InputOffset()))
+			if i >= len(b) || b[i] != ':' {
+				return 0, 0, fmt.Errorf("expected ':' after %q", name)
+			}
+			if name == k {
+				return jsonValueRange(b, i+1, keyPath[1:])
+			}
+			if i, err = jsonSkip(b, skipSpace(b, i+1)); err != nil {
+				return 0, 0, err
+			}
+			if i = skipSpace(b, i); i < len(b) && b[i] == ',' {
+				i = skipSpace(b, i+1)
+			}
+		}
+		return 0, 0, fmt.Errorf("unable to find key %q", k)
+	case int:
+		if i >= len(b) || b[i] != '[' {
+			return 0, 0, fmt.Errorf("expected an array for index %d", k)
+		}
+		for x, i := 0, skipSpace(b, i+1); i < len(b) && b[i] != ']'; x++ {
+			if x == k {
+				return jsonValueRange(b, i, keyPath[1:])
+			}
+			if i, err = jsonSkip(b, i); err != nil {
+				return 0, 0, err
+			}
+			if i = skipSpace(b, i); i < len(b) && b[i] == ',' {
+				i = skipSpace(b, i+1)
+			}
+		}
+		return 0, 0, fmt.Errorf("unable to find index %d", k)
+	}
+	return 0, 0, fmt.Errorf("invalid key %v", keyPath[0])
+}
+
+// jsonSkip returns the offset following the JSON value that starts at offset i
+func jsonSkip(b []byte, i int) (int, error) {
+	var raw json.RawMessage
+	dec := json.NewDecoder(bytes.NewReader(b[i:]))
+	if err := dec.Decode(&raw); err != nil {
+		return 0, err
+	}
+	return i + int(dec.InputOffset()), nil
+}
+
+func skipSpace(b []byte, i int) int {
+	for i < len(b) && (b[i] == ' ' || b[i] == '\t' || b[i] == '\n' || b[i] == '\r') {
+		i++
+	}
+	return i
+}
+
+// setTOML replaces the raw bytes of the value at keyPath, retaining the formatting and comments of the rest of the document
+func setTOML(b []byte, keyPath []interface{}, value string) ([]byte, error) {
+	var target []string
+	for _, k := range keyPath {
+		str, ok := k.(string)
+		if !ok {
+			return nil, fmt.Errorf("values within arrays of TOML tables can not be set")
+		}
+		target = append(target, str)
+	}
+
+	p := unstable.Parser{}
+	p.Reset(b)
+	var found *unstable.Node
+	// find walks inline tables in the same manner as keyOrders
+	var find func(keyPath []string, value *unstable.Node)
+	find = func(keyPath []string, value *unstable.Node) {
+		if found != nil || value == nil {
+			return
+		}
+		if equalKeys(keyPath, target) {
+			found = value
+			return
+		}
+		if value.Kind != unstable.InlineTable {
+			return
+		}
+		children := value.Children()
+		for children.Next() {
+			kv := children.Node()
+			find(joinKeys(keyPath, keyParts(kv)), kv.Value())
+		}
+	}
+	var table []string
+	for found == nil && p.NextExpression() {
+		expr := p.Expression()
+		switch expr.Kind {
+		case unstable.Table, unstable.ArrayTable:
+			table = keyParts(expr)
+		case unstable.KeyValue:
+			find(joinKeys(table, keyParts(expr)), expr.Value())
+		}
+	}
+	if err := p.Error(); err != nil {
+		return nil, err
+	}
+	if found == nil {
+		return nil, fmt.Errorf("unable to find key %q", strings.Join(target, "."))
+	}
+
+	raw := found.Raw
+	switch found.Kind {
+	case unstable.String, unstable.Integer, unstable.Float:
+	case unstable.Bool, unstable.LocalDate, unstable.LocalTime, unstable.LocalDateTime, unstable.DateTime:
+		if raw.Length == 0 {
+			raw = p.Range(found.Data)
+		}
+	default:
+		return nil, &NotASimpleValueError{Key: target[len(target)-1], Value: found.Kind.String()}
+	}
+
+	newValue := []byte(value)
+	// retain non-string types if the new value is of a TOML scalar type
+	var parsed map[string]interface{}
+	if found.Kind == unstable.String || tomlv2.Unmarshal([]byte("v = "+value), &parsed) != nil || !IsSimpleValue(parsed["v"]) {
+		quoted, err := tomlv2.Marshal(map[string]string{"v": value})
+		if err != nil {
+			return nil, err
+		}
+		newValue = bytes.TrimSuffix(bytes.TrimPrefix(quoted, []byte("v = ")), []byte("\n"))
+	}
+	start, end := int(raw.Offset), int(raw.Offset+raw.Length)
+	return append(append(append([]byte{}, b[:start]...), newValue...), b[end:]...), nil
+}
+
+func equalKeys(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// setDotenv replaces the value of a single line dotenv assignment, retaining any "export " prefix and trailing comment
+func setDotenv(b []byte, name, value string) ([]byte, error) {
+	lineRegexp := regexp.MustCompile(`(?m)^([ \t]*(?:export[ \t]+)?` + regexp.QuoteMeta(name) + `[ \t]*=[ \t]*)(.*)$`)
+	match := lineRegexp.FindSubmatchIndex(b)
+	if match == nil {
+		return nil, fmt.Errorf("unable to find key %q", name)
+	}
+	start, end := match[4], match[5]
+	current := string(b[start:end])
+	if q := current; len(q) > 0 && (q[0] == '"' || q[0] == '\'') {
+		closing := -1
+		for i := 1; i < len(q); i++ {
+			if q[0] == '"' && q[i] == '\\' {
+				i++
+			} else if q[i] == q[0] {
+				closing = i
+				break
+			}
+		}
+		if closing < 0 {
+			return nil, fmt.Errorf("multi-line dotenv values can not be set")
+		}
+		end = start + closing + 1
+	} else if i := strings.Index(current, " #"); i >= 0 {
+		end = start + len(strings.TrimRight(current[:i], " \t"))
+	} else {
+		end = start + len(strings.TrimRight(current, " \t\r"))
+	}
+	var quote byte
+	if current != "" && (current[0] == '"' || current[0] == '\'') {
+		quote = current[0]
+	}
+	newValue := dotenvValue(value, quote)
+	return append(append(append([]byte{}, b[:start]...), newValue...), b[end:]...), nil
+}
+
+var (
+	plainDotenvRegexp = regexp.MustCompile("^[^\\s#'\"\\\\$`]+$")
+	// dotenvEscaper escapes the same characters as godotenv.Marshal
+	dotenvEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, "\r", `\r`, `"`, `\"`, `!`, `\!`, `$`, `\$`, "`", "\\`")
+)
+
+// dotenvValue writes a dotenv value using the given quote character, or unquoted if quote is 0.
+// Values that can not be written in that style are double quoted
+func dotenvValue(value string, quote byte) string {
+	switch {
+	case quote == 0 && plainDotenvRegexp.MatchString(value):
+		return value
+	case quote == '\'' && !strings.ContainsAny(value, "'\n\r"):
+		return "'" + value + "'"
+	}
+	return `"` + dotenvEscaper.Replace(value) + `"`
+}
@@ -0,0 +1,97 @@
+package cogs
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ShellDialect represents the shell syntax used when a Config is output using the Shell Format
+type ShellDialect string
+
+// ShellDialects supported by MarshalShell
+const (
+	Sh   ShellDialect = "sh"   // POSIX compatible shells: sh, bash, zsh
+	Fish ShellDialect = "fish" // fish shell
+	Pwsh ShellDialect = "pwsh" // PowerShell
+)
+
+// Validate ensures that a string maps to a valid ShellDialect
+func (sh ShellDialect) Validate() error {
+	switch sh {
+	case Sh, Fish, Pwsh:
+		return nil
+	}
+	return fmt.Errorf("%s is an invalid ShellDialect", string(sh))
+}
+
+var shellVarRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// MarshalShell serializes a Config as a script that exports every key as an environment variable.
+// Values are single quoted so that newlines, quotes, "$", and backticks are never evaluated by the shell:
+//
+//	sh:   export K='v'
+//	fish: set -gx K 'v'
+//	pwsh: $env:K = 'v'
+//
+// The Config should be generated using the Shell Format so that every value is a string
+func MarshalShell(cfg *Config, sh ShellDialect) ([]byte, error) {
+	return marshalShell(cfg, sh, false)
+}
+
+// MarshalShellUnset serializes a script that removes every key of a Config from the environment
+func MarshalShellUnset(cfg *Config, sh ShellDialect) ([]byte, error) {
+	return marshalShell(cfg, sh, true)
+}
+
+func marshalShell(cfg *Config, sh ShellDialect, unset bool) ([]byte, error) {
+	if err := sh.Validate(); err != nil {
+		return nil, err
+	}
+	var sb strings.Builder
+	for _, k := range cfg.Keys {
+		if !shellVarRegexp.MatchString(k) {
+			return nil, fmt.Errorf("%q is not a valid environment variable name", k)
+		}
+		if unset {
+			sb.WriteString(shellUnset(sh, k))
+			sb.WriteByte('\n')
+			continue
+		}
+		v, err := SimpleValueToString(cfg.Values[k])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", k, err)
+		}
+		sb.WriteString(shellExport(sh, k, v))
+		sb.WriteByte('\n')
+	}
+	return []byte(sb.String()), nil
+}
+
+func shellExport(sh ShellDialect, k, v string) string {
+	switch sh {
+	case Fish:
+		// fish single quotes only treat \' and \\ as escape sequences
+		v = strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v)
+		return fmt.Sprintf("set -gx %s '%s'", k, v)
+	case Pwsh:
+		// PowerShell also treats typographic single quotes as quotation marks
+		v = strings.NewReplacer("'", "''", "\u2018", "\u2018\u2018", "\u2019", "\u2019\u2019",
+			"\u201a", "\u201a\u201a", "\u201b", "\u201b\u201b").Replace(v)
+		return fmt.Sprintf("$env:%s = '%s'", k, v)
+	default:
+		// sh single quotes can not be escaped, close the quote and append an escaped quote instead
+		return fmt.Sprintf("export %s='%s'", k, strings.ReplaceAll(v, `'`, `'\''`))
+	}
+}
+
+func shellUnset(sh ShellDialect, k string) string {
+	switch sh {
+	case Fish:
+		return "set -e " + k
+	case Pwsh:
+		return fmt.Sprintf("Remove-Item Env:%s -ErrorAction SilentlyContinue", k)
+	default:
+		return "unset " + k
+	}
+}
@@ -0,0 +1,352 @@
+package cogs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	tomlv2 "github.com/pelletier/go-toml/v2"
+	"github.com/pelletier/go-toml/v2/unstable"
+	"gopkg.in/yaml.v3"
+)
+
+// A table of a cog file is SOPS encrypted when it holds a sops subtable, in the same layout
+// that SOPS uses for YAML and JSON files. A [sops] table at the root encrypts the whole manifest:
+//
+//	[secrets]
+//	api_key = "ENC[AES256_GCM,data:...,type:str]"
+//	[secrets.sops]
+//	mac = "ENC[AES256_GCM,data:...,type:str]"
+//	lastmodified = "2021-01-01T00:00:00Z"
+//	[[secrets.sops.pgp]]
+//	fp = "FBC7B9E2A4F9289AC0C1D4843D16CEE4A27381B4"
+//	enc = "-----BEGIN PGP MESSAGE-----..."
+//
+// SOPS does not support TOML, so tables are decrypted as JSON documents with lexically sorted keys
+// and are written by `cogs set`
+
+// isSOPSTable returns true if a table of a cog file holds SOPS metadata
+func isSOPSTable(node *yaml.Node) bool {
+	return mappingValue(mappingValue(node, "sops"), "mac") != nil
+}
+
+// sopsTable returns the innermost SOPS table of a cog file that holds the node found at subPath, if any.
+// decrypted marks the SOPS tables that were already replaced by their plaintext
+func (vi *visitor) sopsTable(subPath string, decrypted map[*yaml.Node]bool) (*yaml.Node, error) {
+	target, err := vi.get(subPath)
+	if err != nil {
+		return nil, err
+	}
+	keyPath, ok := nodePath(vi.rootNode, target)
+	if !ok {
+		return nil, fmt.Errorf("unable to locate %q", subPath)
+	}
+	var table *yaml.Node
+	node := vi.rootNode
+	for i := 0; node != nil; i++ {
+		if decrypted[node] || isSOPSTable(node) {
+			table = node
+		}
+		if i == len(keyPath) {
+			break
+		}
+		switch k := keyPath[i].(type) {
+		case string:
+			node = mappingValue(node, k)
+		case int:
+			node = node.Content[k]
+		}
+	}
+	return table, nil
+}
+
+// decryptSelf decrypts the SOPS table of the cog file that a self path Link reads from, replacing the table
+// with its plaintext in the source's Visitor. It returns false if the Link is not read from a SOPS table
+func (g *Gear) decryptSelf(src *source, link *Link, keys KeyConfig) (bool, error) {
+	vi := src.Visitor.(*visitor)
+	table, err := vi.sopsTable(link.SubPath, src.tables)
+	if err != nil {
+		// missing subpaths are reported once the Link is visited
+		return false, nil
+	}
+	if table == nil {
+		if link.decrypt() {
+			return false, &DecryptError{Path: g.filePath, Err: fmt.Errorf("%s does not hold SOPS metadata", link.SubPath)}
+		}
+		return false, nil
+	}
+	if src.tables[table] || NoDecrypt || NoEnc {
+		return true, nil
+	}
+	tablePath, _ := nodePath(vi.rootNode, table)
+	f, err := decryptTable(table, tableName(g.filePath, tablePath), keys)
+	if err != nil {
+		return false, err
+	}
+	plainData, err := f.plaintext()
+	if err != nil {
+		return false, err
+	}
+	plain := &yaml.Node{}
+	if err := yaml.Unmarshal(plainData, plain); err != nil {
+		return false, err
+	}
+	*table = *plain.Content[0]
+	src.tables[table] = true
+	return true, nil
+}
+
+// decryptTable decrypts a SOPS table of a cog file, name identifies the table in errors
+func decryptTable(table *yaml.Node, name string, keys KeyConfig) (*sopsFile, error) {
+	encData, err := tableJSON(table)
+	if err != nil {
+		return nil, err
+	}
+	return decryptSOPSFormat(JSON, name, encData, keys)
+}
+
+// tableJSON encodes a table of a cog file as a JSON document, keys are sorted so that the SOPS MAC
+// does not depend on the order that keys are declared in
+func tableJSON(table *yaml.Node) ([]byte, error) {
+	var i interface{}
+	if err := table.Decode(&i); err != nil {
+		return nil, err
+	}
+	if _, ok := i.(map[string]interface{}); !ok {
+		return nil, fmt.Errorf("only tables can be encrypted, found %s", kindStr[table.Kind])
+	}
+	return json.Marshal(i)
+}
+
+// tableName identifies a table of a cog file: "app.cog.toml:.secrets"
+func tableName(cogPath string, tablePath []interface{}) string {
+	if len(tablePath) == 0 {
+		return cogPath
+	}
+	var keys []string
+	for _, k := range tablePath {
+		keys = append(keys, fmt.Sprint(k))
+	}
+	return cogPath + ":" + subPathJoin("", keys...)
+}
+
+// setSelf replaces a value that a self path Link reads from the cog file data b.
+// A value within a SOPS table is re-encrypted along with the rest of the table using the table's data key,
+// and if the Link is encrypted but its table holds no SOPS metadata yet, the table is encrypted
+// for the master keys of the nearest .sops.yaml file. decrypted is true if an existing SOPS table was decrypted
+func setSelf(b []byte, cogPath string, link *Link, value string, keys KeyConfig) (out []byte, decrypted bool, err error) {
+	v, err := NewTOMLVisitor(b)
+	if err != nil {
+		return nil, false, err
+	}
+	vi := v.(*visitor)
+	table, err := vi.sopsTable(link.SubPath, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	if table == nil && !link.encrypted {
+		out, err = setValue(TOML, b, link.SubPath, link.SearchName, value)
+		return out, false, err
+	}
+
+	target, err := vi.get(link.SubPath)
+	if err != nil {
+		return nil, false, err
+	}
+	keyPath, _ := nodePath(vi.rootNode, target)
+	keyPath = append(keyPath, link.SearchName)
+	encrypted := table != nil
+	if !encrypted {
+		table = target
+	}
+	tablePath, _ := nodePath(vi.rootNode, table)
+	// the path of the value within the table's document
+	valuePath := keyPath[len(tablePath):]
+
+	var f *sopsFile
+	if encrypted {
+		if f, err = decryptTable(table, tableName(cogPath, tablePath), keys); err != nil {
+			return nil, false, err
+		}
+		decrypted = true
+		plainData, err := f.plaintext()
+		if err != nil {
+			return nil, decrypted, err
+		}
+		if plainData, err = setJSON(plainData, valuePath, value); err != nil {
+			return nil, decrypted, err
+		}
+		if f.tree.Branches, err = f.store.LoadPlainFile(plainData); err != nil {
+			return nil, decrypted, err
+		}
+	} else {
+		plainData, err := tableJSON(table)
+		if err != nil {
+			return nil, false, err
+		}
+		if plainData, err = setJSON(plainData, valuePath, value); err != nil {
+			return nil, false, err
+		}
+		_, rule, err := creationRule(cogPath)
+		if err != nil {
+			return nil, false, err
+		}
+		// the contexts of an encrypted manifest must remain readable
+		if len(tablePath) == 0 && rule.EncryptedRegex == "" && rule.EncryptedSuffix == "" {
+			return nil, false, fmt.Errorf("the whole cog file can only be encrypted by a creation rule with an encrypted_regex or encrypted_suffix")
+		}
+		if f, err = newSOPSFile(JSON, plainData, rule, keys); err != nil {
+			return nil, false, err
+		}
+	}
+	encData, err := f.emit()
+	if err != nil {
+		return nil, decrypted, err
+	}
+	out, err = writeTable(b, table, tablePath, encData, encrypted)
+	return out, decrypted, err
+}
+
+var sopsHeaderRegexp = regexp.MustCompile(`(?m)^(\[\[?)sops\b`)
+
+// writeTable writes the values of an encrypted SOPS JSON document that differ from table to the table at tablePath
+// of the cog file data b. The SOPS metadata of a table that was already encrypted is updated in place,
+// otherwise it is appended as a subtable
+func writeTable(b []byte, table *yaml.Node, tablePath []interface{}, encData []byte, encrypted bool) ([]byte, error) {
+	doc := &yaml.Node{}
+	if err := yaml.Unmarshal(encData, doc); err != nil {
+		return nil, err
+	}
+	root := doc.Content[0]
+	var err error
+	var write func(node, old *yaml.Node, keyPath []interface{}) error
+	write = func(node, old *yaml.Node, keyPath []interface{}) error {
+		switch {
+		case node.Kind == yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				k := node.Content[i].Value
+				if err := write(node.Content[i+1], mappingValue(old, k), append(keyPath[:len(keyPath):len(keyPath)], k)); err != nil {
+					return err
+				}
+			}
+		case node.Kind == yaml.ScalarNode:
+			if old != nil && old.Kind == yaml.ScalarNode && old.Value == node.Value {
+				return nil
+			}
+			b, err = setTOML(b, keyPath, node.Value)
+			return err
+		case !equalNodes(node, old):
+			return fmt.Errorf("arrays within encrypted tables are not supported")
+		}
+		return nil
+	}
+
+	meta := mappingValue(root, "sops")
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		k := root.Content[i].Value
+		if k == "sops" {
+			continue
+		}
+		if err := write(root.Content[i+1], mappingValue(table, k), append(tablePath[:len(tablePath):len(tablePath)], k)); err != nil {
+			return nil, err
+		}
+	}
+	if encrypted {
+		// the master keys hold the same data key, so only the MAC and its timestamp change
+		metaPath := append(tablePath[:len(tablePath):len(tablePath)], "sops")
+		for _, k := range []string{"lastmodified", "mac"} {
+			if err := write(mappingValue(meta, k), nil, append(metaPath[:len(metaPath):len(metaPath)], k)); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	}
+
+	var metadata interface{}
+	if err := meta.Decode(&metadata); err != nil {
+		return nil, err
+	}
+	text, err := tomlv2.Marshal(map[string]interface{}{"sops": metadata})
+	if err != nil {
+		return nil, err
+	}
+	var prefix string
+	for _, k := range tablePath {
+		str, ok := k.(string)
+		if !ok {
+			return nil, fmt.Errorf("tables within arrays can not be encrypted")
+		}
+		prefix += tomlKey(str) + "."
+	}
+	text = sopsHeaderRegexp.ReplaceAll(text, []byte("${1}"+prefix+"sops"))
+	return append(append(bytes.TrimRight(b, "\n"), "\n\n"...), text...), nil
+}
+
+// removeTables removes every table and array of tables at or below keyPath from the cog file data b,
+// each running from its header to the next header
+func removeTables(b []byte, keyPath []string) ([]byte, error) {
+	p := unstable.Parser{}
+	p.Reset(b)
+	var out []byte
+	var table []string
+	start, removing := 0, false
+	for p.NextExpression() {
+		expr := p.Expression()
+		switch expr.Kind {
+		case unstable.Table, unstable.ArrayTable:
+			key := expr.Key()
+			key.Next()
+			offset := int(p.Range(key.Node().Data).Offset)
+			header := bytes.LastIndexByte(b[:offset], '\n') + 1
+			table = keyParts(expr)
+			if remove := hasKeyPrefix(table, keyPath); remove != removing {
+				if remove {
+					out = append(out, b[start:header]...)
+				}
+				start, removing = header, remove
+			}
+		case unstable.KeyValue:
+			if !removing && hasKeyPrefix(joinKeys(table, keyParts(expr)), keyPath) {
+				return nil, fmt.Errorf("%s must be declared using table headers to be replaced", strings.Join(keyPath, "."))
+			}
+		}
+	}
+	if err := p.Error(); err != nil {
+		return nil, err
+	}
+	if !removing {
+		out = append(out, b[start:]...)
+	}
+	return out, nil
+}
+
+// hasKeyPrefix returns true if keyPath starts with prefix
+func hasKeyPrefix(keyPath, prefix []string) bool {
+	return len(keyPath) >= len(prefix) && equalKeys(keyPath[:len(prefix)], prefix)
+}
+
+// equalNodes returns true if two nodes decode to the same value
+func equalNodes(a, b *yaml.Node) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	var i, j interface{}
+	if a.Decode(&i) != nil || b.Decode(&j) != nil {
+		return false
+	}
+	return reflect.DeepEqual(i, j)
+}
+
+var bareKeyRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// tomlKey quotes a TOML key unless it is a bare key
+func tomlKey(k string) string {
+	if bareKeyRegexp.MatchString(k) {
+		return k
+	}
+	return strconv.Quote(k)
+}
@@ -0,0 +1,18 @@
+locals {
+  region   = "us-east-1"
+  replicas = 3
+  zones    = ["us-east-1a", "us-east-1b"]
+  # expressions are only evaluated by terraform, cogs skips them
+  name = "billing-${var.env}"
+}
+
+variable "instance_type" {
+  default = "t3.micro"
+}
+
+variable "tags" {
+  default = {
+    team = "billing"
+    cost = "shared"
+  }
+}
@@ -0,0 +1,164 @@
+package cogs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"text/template"
+
+	"github.com/mikefarah/yq/v4/pkg/yqlib"
+	"gopkg.in/yaml.v3"
+)
+
+// TransformFunc derives a new value from a resolved Link value,
+// arg holds any text following the "<name>:" prefix of a transform string:
+// "yq:.foo" calls the "yq" TransformFunc with an arg of ".foo"
+type TransformFunc func(value interface{}, arg string) (interface{}, error)
+
+// transforms holds every registered TransformFunc by name
+var transforms = map[string]TransformFunc{
+	"trim":         stringTransform(strings.TrimSpace),
+	"lower":        stringTransform(strings.ToLower),
+	"upper":        stringTransform(strings.ToUpper),
+	"base64encode": stringTransform(func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }),
+	"base64decode": base64Decode,
+	"sha256":       stringTransform(func(s string) string { sum := sha256.Sum256([]byte(s)); return hex.EncodeToString(sum[:]) }),
+	"hostname":     hostname,
+	"yq":           yqTransform,
+	"template":     templateTransform,
+}
+
+// RegisterTransform allows a TransformFunc to be referenced by name in a var.transform list,
+// registering an existing name replaces the previous TransformFunc.
+// RegisterTransform is not safe to call concurrently with Generate and should be called on initialization
+func RegisterTransform(name string, fn TransformFunc) {
+	transforms[name] = fn
+}
+
+// parseTransform splits a transform string into its registered name and argument
+func parseTransform(transform string) (name, arg string) {
+	name, arg, _ = strings.Cut(transform, ":")
+	return name, arg
+}
+
+// decodeTransforms validates that a var.transform value maps to a string or array of registered transform strings
+func decodeTransforms(v interface{}) ([]string, error) {
+	var list []string
+	switch t := v.(type) {
+	case string:
+		list = []string{t}
+	case []interface{}:
+		for _, el := range t {
+			str, ok := el.(string)
+			if !ok {
+				return nil, fmt.Errorf("must be a string or array of strings")
+			}
+			list = append(list, str)
+		}
+	default:
+		return nil, fmt.Errorf("must be a string or array of strings")
+	}
+	for _, transform := range list {
+		if name, _ := parseTransform(transform); transforms[name] == nil {
+			return nil, fmt.Errorf("%q is not a registered transform", name)
+		}
+	}
+	return list, nil
+}
+
+// applyTransforms runs every transform of a Link in order, replacing Link.Value,
+// encrypted values that were not decrypted are left as is
+func applyTransforms(link *Link) (err error) {
+	if link.encrypted && NoDecrypt {
+		return nil
+	}
+	for _, transform := range link.transforms {
+		name, arg := parseTransform(transform)
+		fn, ok := transforms[name]
+		if !ok {
+			return fmt.Errorf("%s: %q is not a registered transform", link.KeyName, name)
+		}
+		if link.Value, err = fn(link.Value, arg); err != nil {
+			return fmt.Errorf("%s: transform %q: %w", link.KeyName, transform, err)
+		}
+	}
+	return nil
+}
+
+// stringTransform turns a string function into a TransformFunc that accepts simple values
+func stringTransform(fn func(string) string) TransformFunc {
+	return func(value interface{}, _ string) (interface{}, error) {
+		str, err := SimpleValueToString(value)
+		if err != nil {
+			return nil, err
+		}
+		return fn(str), nil
+	}
+}
+
+func base64Decode(value interface{}, _ string) (interface{}, error) {
+	str, err := SimpleValueToString(value)
+	if err != nil {
+		return nil, err
+	}
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(str))
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// hostname returns the host of a URL value without the port
+func hostname(value interface{}, _ string) (interface{}, error) {
+	str, err := SimpleValueToString(value)
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(str)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("%q does not contain a host", str)
+	}
+	return u.Hostname(), nil
+}
+
+// yqTransform evaluates a yq expression against a value,
+// string values are deserialized as YAML (and thus JSON) before evaluation
+func yqTransform(value interface{}, expression string) (interface{}, error) {
+	node := &yaml.Node{}
+	if str, ok := value.(string); ok {
+		if err := yaml.Unmarshal([]byte(str), node); err != nil {
+			return nil, err
+		}
+	} else if err := node.Encode(value); err != nil {
+		return nil, err
+	}
+	result, err := evaluateNode(yqlib.NewAllAtOnceEvaluator(), expression, node)
+	if err != nil {
+		return nil, err
+	}
+	var i interface{}
+	if err := result.Decode(&i); err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+// templateTransform executes a text/template with the value as its data: "template:{{.}}:5432"
+func templateTransform(value interface{}, text string) (interface{}, error) {
+	tmpl, err := template.New("transform").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, value); err != nil {
+		return nil, err
+	}
+	return buf.String(), nil
+}
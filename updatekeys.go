@@ -0,0 +1,259 @@
+package cogs
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/getsops/sops/v3/cmd/sops/common"
+	"github.com/getsops/sops/v3/config"
+	"github.com/pelletier/go-toml"
+)
+
+// KeyUpdate describes how the master keys of a SOPS file referenced by a cog file differ
+// from the creation rules of the .sops.yaml file that applies to it
+type KeyUpdate struct {
+	Path    string
+	Config  string   // the .sops.yaml file holding the creation rule
+	Added   []string // master keys added by the creation rule
+	Removed []string // master keys no longer present in the creation rule
+	Rotated bool     // a new data key was generated
+	// ShamirThreshold is the key group threshold set by the creation rule if it differs from the file's, 0 otherwise
+	ShamirThreshold int
+}
+
+// Changed returns true if the SOPS file was, or would be, updated
+func (u *KeyUpdate) Changed() bool {
+	return len(u.Added) > 0 || len(u.Removed) > 0 || u.Rotated || u.ShamirThreshold != 0
+}
+
+// UpdateKeys syncs the master keys of every local SOPS file referenced by the given contexts
+// with the creation rules of the nearest .sops.yaml file, each context name can be a path.Match pattern
+// and every context is used if no names are given.
+// If rotate is true a new data key is generated for every file as well.
+// If dryRun is true no file is written and the returned KeyUpdates describe what would change
+func UpdateKeys(cogPath string, dryRun, rotate bool, ctxNames ...string) ([]*KeyUpdate, error) {
+	files, err := sopsFiles(cogPath, ctxNames)
+	if err != nil {
+		return nil, err
+	}
+	var updates []*KeyUpdate
+	for _, filePath := range files.paths {
+		var update *KeyUpdate
+		if tablePath, ok := files.tables[filePath]; ok {
+			update, err = updateTableKeys(cogPath, tablePath, files.keys[filePath], dryRun, rotate)
+		} else {
+			update, err = updateKeys(filePath, files.keys[filePath], dryRun, rotate)
+		}
+		if err != nil {
+			return updates, fmt.Errorf("%s: %w", filePath, err)
+		}
+		updates = append(updates, update)
+	}
+	return updates, nil
+}
+
+// sopsPaths are the sorted SOPS file paths of a cog file along with the KeyConfig used to decrypt each one,
+// the SOPS tables of the cog file itself are named by tableName
+type sopsPaths struct {
+	paths  []string
+	keys   map[string]KeyConfig
+	tables map[string][]interface{} // the key path of every SOPS table of the cog file
+}
+
+// sopsFiles returns every local path that a context declares as encrypted or that holds SOPS metadata,
+// along with the SOPS tables of the cog file that a context reads through the self path
+func sopsFiles(cogPath string, ctxNames []string) (*sopsPaths, error) {
+	m, err := loadManifest(cogPath)
+	if err != nil {
+		return nil, err
+	}
+	names, err := m.matchContexts(ctxNames)
+	if err != nil {
+		return nil, err
+	}
+	cogNode, err := NewTOMLVisitor(m.fileValue)
+	if err != nil {
+		return nil, err
+	}
+	cog := cogNode.(*visitor)
+	files := &sopsPaths{keys: make(map[string]KeyConfig), tables: make(map[string][]interface{})}
+	for _, ctxName := range names {
+		ctxTree, ok := m.tree.Get(ctxName).(*toml.Tree)
+		if !ok {
+			return nil, &MissingContextError{Ctx: ctxName, Path: cogPath}
+		}
+		ctx, err := decodeContext(ctxTree)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", ctxName, err)
+		}
+		linkMap, err := parseCtx(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", ctxName, err)
+		}
+		gear := m.newGear(ctxName, JSON, nil)
+		keys, err := gear.keyConfig(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", ctxName, err)
+		}
+		for _, link := range linkMap {
+			if link.Path == selfPath {
+				table, err := cog.sopsTable(link.SubPath, nil)
+				if err != nil || table == nil {
+					continue
+				}
+				tablePath, _ := nodePath(cog.rootNode, table)
+				name := tableName(cogPath, tablePath)
+				if _, ok := files.keys[name]; !ok {
+					files.keys[name] = keys
+					files.tables[name] = tablePath
+					files.paths = append(files.paths, name)
+				}
+				continue
+			}
+			// remote files can not be rewritten
+			if link.Path == "" || link.remote || link.readType == rGear {
+				continue
+			}
+			filePath := gear.getLinkFilePath(link.Path)
+			if _, ok := files.keys[filePath]; ok {
+				continue
+			}
+			if !link.encrypted {
+				b, err := readFile(filePath)
+				if err != nil || !isSOPSFile(filePath, b) {
+					continue
+				}
+			}
+			files.keys[filePath] = keys
+			files.paths = append(files.paths, filePath)
+		}
+	}
+	sort.Strings(files.paths)
+	return files, nil
+}
+
+// updateKeys syncs the master keys of a single SOPS file, mirroring `sops updatekeys`
+func updateKeys(filePath string, keys KeyConfig, dryRun, rotate bool) (*KeyUpdate, error) {
+	update := &KeyUpdate{Path: filePath, Rotated: rotate}
+	var rule *config.Config
+	var err error
+	if update.Config, rule, err = creationRule(filePath); err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return nil, err
+	}
+	encData, err := readFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	b, err := rekey(update, FormatForPath(filePath), encData, rule, keys, dryRun)
+	if err != nil || b == nil {
+		return update, err
+	}
+	return update, os.WriteFile(filePath, b, info.Mode())
+}
+
+// updateTableKeys syncs the master keys of a SOPS table of the cog file with the creation rule for the cog file,
+// the table's SOPS metadata is replaced and its values are re-encrypted in place
+func updateTableKeys(cogPath string, tablePath []interface{}, keys KeyConfig, dryRun, rotate bool) (*KeyUpdate, error) {
+	update := &KeyUpdate{Path: tableName(cogPath, tablePath), Rotated: rotate}
+	var rule *config.Config
+	var err error
+	if update.Config, rule, err = creationRule(cogPath); err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(cogPath)
+	if err != nil {
+		return nil, err
+	}
+	b, err := readFile(cogPath)
+	if err != nil {
+		return nil, err
+	}
+	v, err := NewTOMLVisitor(b)
+	if err != nil {
+		return nil, err
+	}
+	table := v.(*visitor).rootNode
+	var metaPath []string
+	for _, k := range tablePath {
+		str, ok := k.(string)
+		if !ok {
+			return nil, fmt.Errorf("tables within arrays can not be encrypted")
+		}
+		table = mappingValue(table, str)
+		metaPath = append(metaPath, str)
+	}
+	if !isSOPSTable(table) {
+		return nil, fmt.Errorf("no longer holds SOPS metadata")
+	}
+	encData, err := tableJSON(table)
+	if err != nil {
+		return nil, err
+	}
+	encData, err = rekey(update, JSON, encData, rule, keys, dryRun)
+	if err != nil || encData == nil {
+		return update, err
+	}
+	// the master keys are arrays of tables, so the metadata is replaced rather than updated in place
+	if b, err = removeTables(b, append(metaPath, "sops")); err != nil {
+		return nil, err
+	}
+	if b, err = writeTable(b, table, tablePath, encData, false); err != nil {
+		return nil, err
+	}
+	return update, os.WriteFile(cogPath, b, info.Mode())
+}
+
+// rekey records how the master keys of SOPS encrypted data differ from a creation rule in update,
+// and returns the data encrypted for the master keys of the rule, or nil if it is unchanged or dryRun is true
+func rekey(update *KeyUpdate, format Format, encData []byte, rule *config.Config, keys KeyConfig, dryRun bool) ([]byte, error) {
+	// only the metadata is needed to compare the master keys, so a dry run does not require any key material
+	tree, err := sopsStore(format).LoadEncryptedFile(encData)
+	if err != nil {
+		return nil, err
+	}
+	for _, diff := range common.DiffKeyGroups(tree.Metadata.KeyGroups, rule.KeyGroups) {
+		for _, key := range diff.Added {
+			update.Added = append(update.Added, key.ToString())
+		}
+		for _, key := range diff.Removed {
+			update.Removed = append(update.Removed, key.ToString())
+		}
+	}
+	// the threshold of the creation rule replaces the file's, and can not exceed the number of key groups
+	threshold := tree.Metadata.ShamirThreshold
+	if rule.ShamirThreshold != 0 {
+		threshold = rule.ShamirThreshold
+	}
+	threshold = min(threshold, len(rule.KeyGroups))
+	if threshold != tree.Metadata.ShamirThreshold {
+		update.ShamirThreshold = threshold
+	}
+	if dryRun || !update.Changed() {
+		return nil, nil
+	}
+
+	f, err := decryptSOPSFormat(format, update.Path, encData, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	f.tree.Metadata.KeyGroups = rule.KeyGroups
+	f.tree.Metadata.ShamirThreshold = threshold
+	var errs []error
+	if update.Rotated {
+		f.dataKey, errs = f.tree.GenerateDataKeyWithKeyServices(f.keyServices)
+	} else {
+		errs = f.tree.Metadata.UpdateMasterKeysWithKeyServices(f.dataKey, f.keyServices)
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("unable to update one or more master keys: %v", errs)
+	}
+	return f.emit()
+}